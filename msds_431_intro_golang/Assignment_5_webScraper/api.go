@@ -0,0 +1,394 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// apiClient talks to the MediaWiki action API of one wiki. Unlike the
+// HTML scraper it does not depend on the skin's CSS classes.
+type apiClient struct {
+	base      string // e.g. https://en.wikipedia.org
+	endpoint  string
+	client    *http.Client
+	userAgent string
+	policy    *crawlPolicy
+	batchSize int // titles per query request; 50 is the limit for non-bots
+}
+
+// apiError is the error object MediaWiki returns instead of a result.
+type apiError struct {
+	Code string `json:"code"`
+	Info string `json:"info"`
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("MediaWiki API error %s: %s", e.Code, e.Info)
+}
+
+func newAPIClient(base string, opts scrapeOptions) *apiClient {
+	base = strings.TrimRight(base, "/")
+	return &apiClient{
+		base:      base,
+		endpoint:  base + "/w/api.php",
+		client:    &http.Client{Transport: opts.transport, Timeout: 30 * time.Second},
+		userAgent: opts.userAgent,
+		policy:    opts.policy,
+		batchSize: 50,
+	}
+}
+
+// get calls the API with params and decodes the JSON response into v.
+// ctx only limits the wait for the crawl delay; a request that has
+// started runs until it completes or times out, though it keeps the
+// values of ctx, such as the page URL for the archive. When m is not
+// nil, the status, size and fetch time of the response are recorded in
+// it.
+func (a *apiClient) get(ctx context.Context, params url.Values, v interface{}, m *pageMetrics) error {
+	params.Set("format", "json")
+	params.Set("formatversion", "2")
+	reqURL := a.endpoint + "?" + params.Encode()
+	if err := a.policy.checkURL(reqURL); err != nil {
+		return err
+	}
+	if err := a.policy.wait(ctx, reqURL); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(context.WithoutCancel(ctx), http.MethodGet, reqURL, nil)
+	if err != nil {
+		return err
+	}
+	if a.userAgent != "" {
+		req.Header.Set("User-Agent", a.userAgent)
+	}
+	start := time.Now()
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if m != nil {
+		m.Status = resp.StatusCode
+		m.Bytes = len(body)
+		m.FetchMillis = millisSince(start)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read response from %s: %w", a.endpoint, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("MediaWiki API %s returned %s", a.endpoint, resp.Status)
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("invalid response from %s: %w", a.endpoint, err)
+	}
+	return nil
+}
+
+// query runs an action=query request, following continuation tokens
+// until the result is complete. handle is called with the "query" object
+// of every response.
+func (a *apiClient) query(ctx context.Context, params url.Values, handle func(json.RawMessage) error) error {
+	params.Set("action", "query")
+	for {
+		var resp struct {
+			Error    *apiError              `json:"error"`
+			Continue map[string]interface{} `json:"continue"`
+			Query    json.RawMessage        `json:"query"`
+		}
+		if err := a.get(ctx, params, &resp, nil); err != nil {
+			return err
+		}
+		if resp.Error != nil {
+			return resp.Error
+		}
+		if len(resp.Query) > 0 {
+			if err := handle(resp.Query); err != nil {
+				return err
+			}
+		}
+		if len(resp.Continue) == 0 {
+			return nil
+		}
+		for k, v := range resp.Continue {
+			params.Set(k, fmt.Sprint(v))
+		}
+	}
+}
+
+// resolveTitles maps every requested title to the canonical title of the
+// page it names, after normalization and redirects. Titles of pages that
+// do not exist are left out. Titles are sent in batches of batchSize.
+func (a *apiClient) resolveTitles(ctx context.Context, titles []string) (map[string]string, error) {
+	resolved := map[string]string{}
+	for start := 0; start < len(titles); start += a.batchSize {
+		end := start + a.batchSize
+		if end > len(titles) {
+			end = len(titles)
+		}
+		batch := titles[start:end]
+
+		renamed := map[string]string{}
+		exists := map[string]bool{}
+		params := url.Values{"titles": {strings.Join(batch, "|")}, "redirects": {"1"}}
+		err := a.query(ctx, params, func(raw json.RawMessage) error {
+			var q struct {
+				Normalized []struct{ From, To string } `json:"normalized"`
+				Redirects  []struct{ From, To string } `json:"redirects"`
+				Pages      []struct {
+					Title   string `json:"title"`
+					Missing bool   `json:"missing"`
+					Invalid bool   `json:"invalid"`
+				} `json:"pages"`
+			}
+			if err := json.Unmarshal(raw, &q); err != nil {
+				return err
+			}
+			for _, n := range q.Normalized {
+				renamed[n.From] = n.To
+			}
+			for _, r := range q.Redirects {
+				renamed[r.From] = r.To
+			}
+			for _, p := range q.Pages {
+				if !p.Missing && !p.Invalid {
+					exists[p.Title] = true
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, title := range batch {
+			final := title
+			for hops := 0; hops < 10; hops++ {
+				next, ok := renamed[final]
+				if !ok {
+					break
+				}
+				final = next
+			}
+			if exists[final] {
+				resolved[title] = final
+			}
+		}
+	}
+	return resolved, nil
+}
+
+// apiParseResult is the response to an action=parse request.
+type apiParseResult struct {
+	Error *apiError `json:"error"`
+	Parse struct {
+		Title     string `json:"title"`
+		Text      string `json:"text"`
+		LangLinks []struct {
+			Lang string `json:"lang"`
+			URL  string `json:"url"`
+		} `json:"langlinks"`
+		Properties struct {
+			WikibaseItem string `json:"wikibase_item"`
+		} `json:"properties"`
+	} `json:"parse"`
+}
+
+// parse fetches the rendered HTML of a page with action=parse and turns
+// it into a record for pageURL.
+func (a *apiClient) parse(ctx context.Context, title, pageURL string, m *pageMetrics) (WebsiteData, error) {
+	var resp apiParseResult
+	params := url.Values{
+		"action":    {"parse"},
+		"page":      {title},
+		"prop":      {"text|langlinks|properties"},
+		"redirects": {"1"},
+	}
+	if err := a.get(withPageURL(ctx, pageURL), params, &resp, m); err != nil {
+		return WebsiteData{}, err
+	}
+	if resp.Error != nil {
+		return WebsiteData{}, resp.Error
+	}
+
+	start := time.Now()
+	if m != nil {
+		defer func() { m.ParseMillis = millisSince(start) }()
+	}
+	return resp.record(pageURL)
+}
+
+// record turns the rendered page into a record for pageURL.
+func (r apiParseResult) record(pageURL string) (WebsiteData, error) {
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return WebsiteData{}, fmt.Errorf("invalid URL %s: %w", pageURL, err)
+	}
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(r.Parse.Text))
+	if err != nil {
+		return WebsiteData{}, fmt.Errorf("failed to parse HTML of %s: %w", r.Parse.Title, err)
+	}
+	data := parseContent(doc.Find("body"), base, pageURL, r.Parse.Title, wikipediaProfile)
+	data.WikidataID = r.Parse.Properties.WikibaseItem
+	for _, l := range r.Parse.LangLinks {
+		if data.LangLinks == nil {
+			data.LangLinks = map[string]string{}
+		}
+		data.LangLinks[l.Lang] = l.URL
+	}
+	return data, nil
+}
+
+// categoryMembers lists the articles of a category, recursing into
+// subcategories down to maxDepth levels, and returns their page URLs.
+func (a *apiClient) categoryMembers(ctx context.Context, category string, maxDepth int) ([]string, error) {
+	category = strings.ReplaceAll(strings.TrimSpace(category), "_", " ")
+	if !strings.HasPrefix(category, "Category:") {
+		category = "Category:" + category
+	}
+
+	type queued struct {
+		title string
+		depth int
+	}
+	var articles []string
+	seen := map[string]bool{category: true}
+	queue := []queued{{title: category}}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		params := url.Values{
+			"list":    {"categorymembers"},
+			"cmtitle": {current.title},
+			"cmtype":  {"page|subcat"},
+			"cmlimit": {"max"},
+		}
+		err := a.query(ctx, params, func(raw json.RawMessage) error {
+			var q struct {
+				Members []struct {
+					NS    int    `json:"ns"`
+					Title string `json:"title"`
+				} `json:"categorymembers"`
+			}
+			if err := json.Unmarshal(raw, &q); err != nil {
+				return err
+			}
+			for _, m := range q.Members {
+				if seen[m.Title] {
+					continue
+				}
+				seen[m.Title] = true
+				switch {
+				case m.NS == 14 && current.depth < maxDepth:
+					queue = append(queue, queued{title: m.Title, depth: current.depth + 1})
+				case m.NS == 0:
+					articles = append(articles, a.pageURL(m.Title))
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s: %w", current.title, err)
+		}
+	}
+	return articles, nil
+}
+
+// pageURL returns the article URL of a title on this wiki.
+func (a *apiClient) pageURL(title string) string {
+	return a.base + "/wiki/" + url.PathEscape(strings.ReplaceAll(title, " ", "_"))
+}
+
+// titleFromURL returns the wiki base URL and the page title of an
+// article URL such as https://en.wikipedia.org/wiki/Android_(robot).
+func titleFromURL(pageURL string) (string, string, error) {
+	u, err := url.Parse(pageURL)
+	if err != nil {
+		return "", "", err
+	}
+	name, ok := strings.CutPrefix(u.Path, "/wiki/")
+	if !ok || name == "" {
+		return "", "", fmt.Errorf("%s is not an article URL", pageURL)
+	}
+	return u.Scheme + "://" + u.Host, strings.ReplaceAll(name, "_", " "), nil
+}
+
+// scrapeAPI fetches the articles at urls through the MediaWiki API and
+// passes each record to save. Titles are resolved in batches first, so
+// redirects and missing pages are known before any page is parsed. No new
+// page is started once ctx is cancelled.
+func scrapeAPI(ctx context.Context, urls []string, opts scrapeOptions, save func(WebsiteData)) {
+	type article struct {
+		pageURL, title string
+	}
+	byWiki := map[string][]article{}
+	var wikis []string
+	for _, pageURL := range urls {
+		base, title, err := titleFromURL(pageURL)
+		if err != nil {
+			fmt.Printf("Skipping %s: %v\n", pageURL, err)
+			continue
+		}
+		if _, ok := byWiki[base]; !ok {
+			wikis = append(wikis, base)
+		}
+		byWiki[base] = append(byWiki[base], article{pageURL, title})
+	}
+
+	var wg sync.WaitGroup
+wikiLoop:
+	for _, base := range wikis {
+		if ctx.Err() != nil {
+			break
+		}
+		client := newAPIClient(base, opts)
+		var titles []string
+		for _, a := range byWiki[base] {
+			titles = append(titles, a.title)
+		}
+		resolved, err := client.resolveTitles(ctx, titles)
+		if err != nil {
+			fmt.Printf("Error resolving titles on %s: %v\n", base, err)
+			continue
+		}
+
+		for _, a := range byWiki[base] {
+			if ctx.Err() != nil {
+				break wikiLoop
+			}
+			canonical, ok := resolved[a.title]
+			if !ok {
+				fmt.Printf("Skipping %s: page does not exist\n", a.pageURL)
+				continue
+			}
+			wg.Add(1)
+			time.Sleep(100 * time.Millisecond)
+
+			go func(pageURL, title string) {
+				defer wg.Done()
+				m := pageMetrics{URL: pageURL}
+				defer func() { opts.metrics.record(m) }()
+				data, err := client.parse(ctx, title, pageURL, &m)
+				if err != nil {
+					fmt.Printf("Error fetching %s: %v\n", pageURL, err)
+					m.Error = err.Error()
+					return
+				}
+				m.setCounts(data)
+				save(data)
+			}(a.pageURL, canonical)
+		}
+	}
+	wg.Wait()
+}
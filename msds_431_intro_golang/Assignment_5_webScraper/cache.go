@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// errNotCached is returned in offline mode for URLs missing from the cache.
+var errNotCached = errors.New("not in cache")
+
+// cacheEntry is the metadata stored next to each cached response body.
+type cacheEntry struct {
+	URL          string      `json:"url"`
+	StatusCode   int         `json:"status_code"`
+	Header       http.Header `json:"header"`
+	ETag         string      `json:"etag,omitempty"`
+	LastModified string      `json:"last_modified,omitempty"`
+	FetchedAt    time.Time   `json:"fetched_at"`
+}
+
+// cachingTransport is an http.RoundTripper that keeps successful GET
+// responses on disk, keyed by URL, and revalidates them with
+// If-None-Match / If-Modified-Since. In offline mode it never touches the
+// network.
+type cachingTransport struct {
+	dir     string
+	offline bool
+	next    http.RoundTripper
+}
+
+func newCachingTransport(dir string, offline bool) (*cachingTransport, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory %s: %w", dir, err)
+	}
+	return &cachingTransport{dir: dir, offline: offline, next: http.DefaultTransport}, nil
+}
+
+// paths returns the metadata and body file names for a URL.
+func (t *cachingTransport) paths(rawURL string) (string, string) {
+	sum := sha256.Sum256([]byte(rawURL))
+	key := hex.EncodeToString(sum[:])
+	return filepath.Join(t.dir, key+".json"), filepath.Join(t.dir, key+".body")
+}
+
+func (t *cachingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet {
+		if t.offline {
+			return nil, fmt.Errorf("%s %s: %w", req.Method, req.URL, errNotCached)
+		}
+		return t.next.RoundTrip(req)
+	}
+
+	rawURL := req.URL.String()
+	entry, body, err := t.load(rawURL)
+	if t.offline {
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", rawURL, errNotCached)
+		}
+		return entry.response(req, body), nil
+	}
+
+	if err == nil {
+		req = req.Clone(req.Context())
+		if entry.ETag != "" {
+			req.Header.Set("If-None-Match", entry.ETag)
+		}
+		if entry.LastModified != "" {
+			req.Header.Set("If-Modified-Since", entry.LastModified)
+		}
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusNotModified && entry != nil {
+		resp.Body.Close()
+		return entry.response(req, body), nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return resp, nil
+	}
+
+	body, err = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	newEntry := &cacheEntry{
+		URL:          rawURL,
+		StatusCode:   resp.StatusCode,
+		Header:       resp.Header,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		FetchedAt:    time.Now().UTC(),
+	}
+	if err := t.store(newEntry, body); err != nil {
+		fmt.Printf("Error caching %s: %v\n", rawURL, err)
+	}
+	return resp, nil
+}
+
+func (t *cachingTransport) load(rawURL string) (*cacheEntry, []byte, error) {
+	metaPath, bodyPath := t.paths(rawURL)
+	meta, err := os.ReadFile(metaPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	var entry cacheEntry
+	if err := json.Unmarshal(meta, &entry); err != nil {
+		return nil, nil, fmt.Errorf("corrupt cache entry %s: %w", metaPath, err)
+	}
+	body, err := os.ReadFile(bodyPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &entry, body, nil
+}
+
+// store writes the body before the metadata, each through a temporary
+// file, so a reader never sees metadata without its body.
+func (t *cachingTransport) store(entry *cacheEntry, body []byte) error {
+	metaPath, bodyPath := t.paths(entry.URL)
+	meta, err := json.MarshalIndent(entry, "", "    ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(bodyPath, body); err != nil {
+		return err
+	}
+	return writeFileAtomic(metaPath, meta)
+}
+
+func writeFileAtomic(name string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+".tmp*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
+
+// response builds an http.Response for req from a cached entry.
+func (e *cacheEntry) response(req *http.Request, body []byte) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", e.StatusCode, http.StatusText(e.StatusCode)),
+		StatusCode:    e.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        e.Header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
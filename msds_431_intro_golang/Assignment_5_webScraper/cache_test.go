@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCachingTransport(t *testing.T) {
+	var hits, notModified int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+		io.WriteString(w, "<p>hello</p>")
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	get := func(offline bool) (string, error) {
+		transport, err := newCachingTransport(dir, offline)
+		if err != nil {
+			t.Fatal(err)
+		}
+		client := &http.Client{Transport: transport}
+		resp, err := client.Get(srv.URL + "/wiki/Robotics")
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		return string(body), err
+	}
+
+	tests := []struct {
+		name            string
+		offline         bool
+		wantHits        int
+		wantNotModified int
+	}{
+		{"First fetch downloads", false, 1, 0},
+		{"Second fetch revalidates", false, 2, 1},
+		{"Offline serves from cache", true, 2, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, err := get(tt.offline)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if body != "<p>hello</p>" {
+				t.Errorf("body = %q", body)
+			}
+			if hits != tt.wantHits || notModified != tt.wantNotModified {
+				t.Errorf("server hits = %d (304s %d), want %d (%d)", hits, notModified, tt.wantHits, tt.wantNotModified)
+			}
+		})
+	}
+}
+
+func TestCachingTransportOfflineMiss(t *testing.T) {
+	transport, err := newCachingTransport(t.TempDir(), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Transport: transport}
+	_, err = client.Get("http://example.invalid/wiki/Robotics")
+	if !errors.Is(err, errNotCached) {
+		t.Errorf("error = %v, want errNotCached", err)
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/gocolly/colly"
+)
+
+// categoryURL returns the page URL of a category on the wiki at base,
+// adding the "Category:" prefix when it is missing.
+func categoryURL(base, category string) string {
+	category = strings.ReplaceAll(strings.TrimSpace(category), " ", "_")
+	if !strings.HasPrefix(category, "Category:") {
+		category = "Category:" + category
+	}
+	return strings.TrimRight(base, "/") + "/wiki/" + url.PathEscape(category)
+}
+
+// crawlCategory walks a category page, following its "next page" links,
+// and returns the URLs of its member articles in the order they were
+// found. Subcategories are walked as well, down to maxDepth levels below
+// the starting category. It gives up when ctx is cancelled.
+func crawlCategory(ctx context.Context, startURL string, maxDepth int, opts scrapeOptions) ([]string, error) {
+	type queued struct {
+		url   string
+		depth int
+	}
+
+	c := newCollector(opts)
+
+	var articles []string
+	seenArticles := map[string]bool{}
+	seenPages := map[string]bool{}
+	queue := []queued{{url: startURL}}
+	var current queued
+
+	// Subcategories wait at the back of the queue; the next page of the
+	// current category is read before them.
+	enqueue := func(e *colly.HTMLElement, href string, depth int, next bool) {
+		u := absoluteURL(e, href)
+		if u == "" || seenPages[u] {
+			return
+		}
+		seenPages[u] = true
+		if next {
+			queue = append([]queued{{url: u, depth: depth}}, queue...)
+		} else {
+			queue = append(queue, queued{url: u, depth: depth})
+		}
+	}
+
+	c.OnHTML("#mw-pages", func(e *colly.HTMLElement) {
+		e.ForEach(".mw-category-group li a[href]", func(_ int, a *colly.HTMLElement) {
+			u := absoluteURL(a, a.Attr("href"))
+			if u != "" && !seenArticles[u] {
+				seenArticles[u] = true
+				articles = append(articles, u)
+			}
+		})
+	})
+
+	c.OnHTML("#mw-subcategories", func(e *colly.HTMLElement) {
+		if current.depth >= maxDepth {
+			return
+		}
+		e.ForEach(".mw-category-group li a[href]", func(_ int, a *colly.HTMLElement) {
+			enqueue(a, a.Attr("href"), current.depth+1, false)
+		})
+	})
+
+	// Both member lists are paginated with a plain "next page" link.
+	c.OnHTML("#mw-pages > a[href], #mw-subcategories > a[href]", func(e *colly.HTMLElement) {
+		if strings.TrimSpace(e.Text) == "next page" {
+			enqueue(e, e.Attr("href"), current.depth, true)
+		}
+	})
+
+	seenPages[startURL] = true
+	for len(queue) > 0 {
+		current, queue = queue[0], queue[1:]
+		// The next pages are under /w/index.php, which robots.txt
+		// disallows; robots.txt is only applied to article pages.
+		if err := opts.policy.checkURL(current.url); err != nil {
+			if current.url == startURL {
+				return nil, fmt.Errorf("cannot read category %s: %w", startURL, err)
+			}
+			fmt.Printf("Skipping %s: %v\n", current.url, err)
+			continue
+		}
+		if err := opts.policy.wait(ctx, current.url); err != nil {
+			return nil, fmt.Errorf("reading category %s interrupted: %w", startURL, err)
+		}
+		fmt.Printf("Reading category page %s\n", current.url)
+		if err := c.Visit(current.url); err != nil {
+			if current.url == startURL {
+				return nil, fmt.Errorf("failed to read category %s: %w", startURL, err)
+			}
+			fmt.Printf("Error visiting %s: %v\n", current.url, err)
+		}
+	}
+	return articles, nil
+}
+
+// absoluteURL resolves href against the page e was found on and drops
+// the fragment.
+func absoluteURL(e *colly.HTMLElement, href string) string {
+	abs := e.Request.AbsoluteURL(href)
+	if abs == "" {
+		return ""
+	}
+	u, err := url.Parse(abs)
+	if err != nil {
+		return ""
+	}
+	u.Fragment = ""
+	return u.String()
+}
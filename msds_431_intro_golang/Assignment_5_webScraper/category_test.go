@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestCategoryURL(t *testing.T) {
+	tests := []struct {
+		category string
+		expected string
+	}{
+		{"Category:Robotics", "https://en.wikipedia.org/wiki/Category:Robotics"},
+		{"Robotics", "https://en.wikipedia.org/wiki/Category:Robotics"},
+		{"Category:Robot operating systems", "https://en.wikipedia.org/wiki/Category:Robot_operating_systems"},
+	}
+	for _, tt := range tests {
+		if got := categoryURL("https://en.wikipedia.org/", tt.category); got != tt.expected {
+			t.Errorf("categoryURL(%q) = %q, want %q", tt.category, got, tt.expected)
+		}
+	}
+}
+
+func TestCrawlCategory(t *testing.T) {
+	srv := newFixtureServer(t)
+	start := categoryURL(srv.URL, "Category:Robotics")
+
+	tests := []struct {
+		name     string
+		depth    int
+		expected []string
+	}{
+		{"Follows pagination", 0, []string{"/wiki/Robotics", "/wiki/Chatbot", "/wiki/Robot_Operating_System"}},
+		{"Recurses into subcategories", 1, []string{"/wiki/Robotics", "/wiki/Chatbot", "/wiki/Robot_Operating_System", "/wiki/Android_(robot)"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := crawlCategory(context.Background(), start, tt.depth, scrapeOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var paths []string
+			for _, u := range got {
+				paths = append(paths, strings.TrimPrefix(u, srv.URL))
+			}
+			if strings.Join(paths, " ") != strings.Join(tt.expected, " ") {
+				t.Errorf("members = %v, want %v", paths, tt.expected)
+			}
+		})
+	}
+}
+
+func TestCrawlCategoryMissing(t *testing.T) {
+	srv := newFixtureServer(t)
+	if _, err := crawlCategory(context.Background(), categoryURL(srv.URL, "Category:Nothing"), 0, scrapeOptions{}); err == nil {
+		t.Error("expected an error for a missing category")
+	}
+}
+
+// TestScrapeCategory scrapes the members of a category that have saved
+// article fixtures.
+func TestScrapeCategory(t *testing.T) {
+	srv := newFixtureServer(t)
+	members, err := crawlCategory(context.Background(), categoryURL(srv.URL, "Robotics"), 0, scrapeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	scrape(context.Background(), members[:2], &buf, scrapeOptions{outDir: t.TempDir()})
+
+	titles := map[string]bool{}
+	scanner := bufio.NewScanner(&buf)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		if strings.Contains(scanner.Text(), `"title":"Robotics"`) {
+			titles["Robotics"] = true
+		}
+		if strings.Contains(scanner.Text(), `"title":"Chatbot"`) {
+			titles["Chatbot"] = true
+		}
+	}
+	if !titles["Robotics"] || !titles["Chatbot"] {
+		t.Errorf("scraped titles = %v, want Robotics and Chatbot", titles)
+	}
+}
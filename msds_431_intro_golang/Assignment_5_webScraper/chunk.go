@@ -0,0 +1,129 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Chunk is a piece of one section of an article, sized for retrieval
+// pipelines.
+type Chunk struct {
+	URL         string   `json:"url"`
+	Title       string   `json:"title"`
+	SectionPath []string `json:"section_path"`
+	ChunkIndex  int      `json:"chunk_index"`
+	Text        string   `json:"text"`
+	Hash        string   `json:"hash"`
+}
+
+// chunkOptions sets the chunk size and the overlap between consecutive
+// chunks of a section, both measured in unit ("chars" or "tokens").
+type chunkOptions struct {
+	size    int
+	overlap int
+	unit    string
+}
+
+// units converts a length in characters to the configured unit. Tokens
+// are estimated at four characters each, which is close enough for sizing
+// chunks for common embedding models.
+func (o chunkOptions) units(chars int) int {
+	if o.unit == "tokens" {
+		return (chars + 3) / 4
+	}
+	return chars
+}
+
+func (o chunkOptions) validate() error {
+	if o.unit != "chars" && o.unit != "tokens" {
+		return fmt.Errorf("unknown chunk unit %q, want chars or tokens", o.unit)
+	}
+	if o.size <= 0 {
+		return fmt.Errorf("chunk size must be positive, got %d", o.size)
+	}
+	if o.overlap < 0 || o.overlap >= o.size {
+		return fmt.Errorf("chunk overlap must be between 0 and the size, got %d", o.overlap)
+	}
+	return nil
+}
+
+// wordWithSpace matches a word and the whitespace that follows it.
+var wordWithSpace = regexp.MustCompile(`\S+\s*`)
+
+// chunkArticle splits every section of an article into chunks. A chunk
+// never spans two sections.
+func chunkArticle(data WebsiteData, opts chunkOptions) []Chunk {
+	var chunks []Chunk
+	for _, sec := range sectionTexts(data) {
+		if len(sec.Paragraphs) == 0 {
+			continue
+		}
+		for _, text := range splitText(strings.Join(sec.Paragraphs, "\n\n"), opts) {
+			sum := sha256.Sum256([]byte(text))
+			chunks = append(chunks, Chunk{
+				URL:         data.URL,
+				Title:       data.Title,
+				SectionPath: sec.Path,
+				ChunkIndex:  len(chunks),
+				Text:        text,
+				Hash:        hex.EncodeToString(sum[:]),
+			})
+		}
+	}
+	return chunks
+}
+
+// splitText cuts text at word boundaries into pieces of at most
+// opts.size, repeating about opts.overlap worth of words at the start of
+// each following piece. A single word longer than the size becomes a
+// piece of its own.
+func splitText(text string, opts chunkOptions) []string {
+	words := wordWithSpace.FindAllString(strings.TrimSpace(text), -1)
+
+	// offsets[i] is the number of characters before words[i]; the length
+	// of words[from:to] leaves out the whitespace after the last word.
+	offsets := make([]int, len(words)+1)
+	for i, w := range words {
+		offsets[i+1] = offsets[i] + utf8.RuneCountInString(w)
+	}
+	length := func(from, to int) int {
+		last := words[to-1]
+		trailing := utf8.RuneCountInString(last) - utf8.RuneCountInString(strings.TrimRight(last, " \t\r\n"))
+		return opts.units(offsets[to] - offsets[from] - trailing)
+	}
+
+	var pieces []string
+	start := 0
+	for start < len(words) {
+		end := start + 1
+		for end < len(words) && length(start, end+1) <= opts.size {
+			end++
+		}
+		pieces = append(pieces, strings.TrimSpace(strings.Join(words[start:end], "")))
+		if end == len(words) {
+			break
+		}
+
+		next := end
+		for next > start+1 && length(next-1, end) <= opts.overlap {
+			next--
+		}
+		start = next
+	}
+	return pieces
+}
+
+// writeChunks writes the chunks of every article to w as JSON lines and
+// returns how many were written.
+func writeChunks(w io.Writer, records []WebsiteData, opts chunkOptions) (int, error) {
+	var chunks []Chunk
+	for _, data := range records {
+		chunks = append(chunks, chunkArticle(data, opts)...)
+	}
+	return len(chunks), writeJSONL(w, chunks)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSplitText(t *testing.T) {
+	text := "one two three four five six seven eight nine ten"
+	tests := []struct {
+		name     string
+		opts     chunkOptions
+		expected []string
+	}{
+		{"Fits in one chunk", chunkOptions{size: 100, unit: "chars"}, []string{text}},
+		{"No overlap", chunkOptions{size: 14, unit: "chars"}, []string{"one two three", "four five six", "seven eight", "nine ten"}},
+		{"With overlap", chunkOptions{size: 14, overlap: 5, unit: "chars"}, []string{"one two three", "three four", "four five six", "six seven", "seven eight", "eight nine ten"}},
+		{"Tokens", chunkOptions{size: 4, unit: "tokens"}, []string{"one two three", "four five six", "seven eight nine", "ten"}},
+		{"Long word", chunkOptions{size: 3, unit: "chars"}, strings.Fields(text)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitText(text, tt.opts)
+			if strings.Join(got, "|") != strings.Join(tt.expected, "|") {
+				t.Errorf("splitText() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestChunkArticle(t *testing.T) {
+	data := parseFixture(t, "chatbot", fixtures["chatbot"])
+	opts := chunkOptions{size: 40, overlap: 10, unit: "chars"}
+	chunks := chunkArticle(data, opts)
+	if len(chunks) == 0 {
+		t.Fatal("no chunks")
+	}
+
+	for i, c := range chunks {
+		if c.ChunkIndex != i {
+			t.Errorf("chunk %d has index %d", i, c.ChunkIndex)
+		}
+		if len(c.Text) > opts.size && strings.Contains(c.Text, " ") {
+			t.Errorf("chunk %d is %d chars: %q", i, len(c.Text), c.Text)
+		}
+		if len(c.Hash) != 64 {
+			t.Errorf("chunk %d hash = %q", i, c.Hash)
+		}
+	}
+
+	// Chunks never span sections: the Turing test and ELIZA paragraphs
+	// must not share a chunk.
+	for _, c := range chunks {
+		if strings.Contains(c.Text, "Turing") && strings.Contains(c.Text, "ELIZA") {
+			t.Errorf("chunk crosses sections: %q", c.Text)
+		}
+	}
+	if got := strings.Join(chunks[len(chunks)-1].SectionPath, " > "); got != "Applications" {
+		t.Errorf("last chunk section = %q, want Applications", got)
+	}
+
+	again := chunkArticle(data, opts)
+	for i := range chunks {
+		if chunks[i].Hash != again[i].Hash {
+			t.Errorf("chunk %d hash is not stable", i)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// sectionText is the plain text of one section of a scraped article.
+// Path holds the titles from the top level section down to this one.
+// Blocks and Tables are only known for records with a section tree.
+type sectionText struct {
+	Path       []string
+	Level      int
+	Paragraphs []string
+	Blocks     []Block
+	Tables     []*TableRef
+}
+
+// Title returns the title of the section itself.
+func (s sectionText) Title() string {
+	return s.Path[len(s.Path)-1]
+}
+
+// readRecords loads a JSON lines file written by the scraper. Records of
+// older schema versions are converted to the current one.
+func readRecords(fileName string) ([]WebsiteData, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file %s: %w", fileName, err)
+	}
+	defer file.Close()
+
+	var records []WebsiteData
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 64<<20)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		data, err := decodeRecord(scanner.Bytes())
+		if err != nil {
+			return nil, fmt.Errorf("invalid record on line %d of %s: %w", line, fileName, err)
+		}
+		records = append(records, data)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read file %s: %w", fileName, err)
+	}
+	return records, nil
+}
+
+// writeJSONL writes every item to w as one line of JSON.
+func writeJSONL[T any](w io.Writer, items []T) error {
+	bw := bufio.NewWriter(w)
+	for i, item := range items {
+		line, err := json.Marshal(item)
+		if err != nil {
+			return fmt.Errorf("failed to marshal line %d: %w", i+1, err)
+		}
+		bw.Write(line)
+		bw.WriteString("\n")
+	}
+	return bw.Flush()
+}
+
+// writeJSONLFile writes the items to fileName as JSON lines. The file is
+// replaced only once every line is written, so it may be the file the
+// items were read from.
+func writeJSONLFile[T any](fileName string, items []T) error {
+	var b bytes.Buffer
+	if err := writeJSONL(&b, items); err != nil {
+		return fmt.Errorf("failed to write %s: %w", fileName, err)
+	}
+	if err := writeFileAtomic(fileName, b.Bytes()); err != nil {
+		return fmt.Errorf("failed to write %s: %w", fileName, err)
+	}
+	return nil
+}
+
+// sectionTexts lists the sections of an article in document order with
+// citation-free paragraph text. Records written before the section tree
+// existed fall back to the ordered sections and their raw text.
+func sectionTexts(data WebsiteData) []sectionText {
+	var out []sectionText
+	if len(data.SectionTree) > 0 {
+		var walk func(sec *Section, path []string)
+		walk = func(sec *Section, path []string) {
+			path = append(path[:len(path):len(path)], sec.Title)
+			st := sectionText{Path: path, Level: sec.Level, Blocks: sec.Blocks, Tables: sec.Tables}
+			for _, p := range sec.Paragraphs {
+				text := p.CleanText
+				if text == "" {
+					text = strings.TrimSpace(p.Text)
+				}
+				if text != "" {
+					st.Paragraphs = append(st.Paragraphs, text)
+				}
+			}
+			out = append(out, st)
+			for _, child := range sec.Children {
+				walk(child, path)
+			}
+		}
+		for _, sec := range data.SectionTree {
+			walk(sec, nil)
+		}
+		return out
+	}
+
+	var path []string
+	for _, sec := range data.Sections {
+		// A section sits below the closest preceding section of a lower
+		// level; the lead is level 1, so h2 sections start new paths.
+		depth := sec.Level - 2
+		if depth < 0 {
+			depth = 0
+		}
+		if depth > len(path) {
+			depth = len(path)
+		}
+		path = append(path[:depth:depth], sec.Title)
+		st := sectionText{Path: path, Level: sec.Level}
+		for _, p := range sec.Paragraphs {
+			if text := strings.TrimSpace(p); text != "" {
+				st.Paragraphs = append(st.Paragraphs, text)
+			}
+		}
+		out = append(out, st)
+	}
+	return out
+}
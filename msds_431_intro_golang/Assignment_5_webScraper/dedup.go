@@ -0,0 +1,389 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"sort"
+	"strings"
+)
+
+// DuplicateCluster is a group of near-identical paragraphs. The first
+// paragraph is the earliest occurrence, the one a deduplicated corpus
+// keeps.
+type DuplicateCluster struct {
+	Paragraphs []DuplicateParagraph `json:"paragraphs"`
+}
+
+// DuplicateParagraph is one member of a cluster. Similarity is the
+// Jaccard similarity of its shingles with those of the first member.
+type DuplicateParagraph struct {
+	URL        string  `json:"url"`
+	Title      string  `json:"title"`
+	Section    string  `json:"section"`
+	Index      int     `json:"index"`
+	Similarity float64 `json:"similarity"`
+	Text       string  `json:"text"`
+}
+
+// paragraphUnit is a paragraph of the corpus and where it is. Section is
+// the position of its section in the record's ordered sections, which is
+// also the pre-order position in the section tree.
+type paragraphUnit struct {
+	record, section, index int
+	path                   []string
+	text                   string
+	shingles               map[uint64]bool
+}
+
+// dedupOptions control what counts as a near duplicate.
+type dedupOptions struct {
+	threshold float64 // minimum Jaccard similarity of the shingle sets
+	shingle   int     // words per shingle
+	minWords  int     // shorter paragraphs are never reported
+	hashes    int     // MinHash signature length
+}
+
+// paragraphUnits lists the paragraphs of every record in document order.
+// Paragraph text is citation-free when the record has a section tree.
+func paragraphUnits(records []WebsiteData) []paragraphUnit {
+	var units []paragraphUnit
+	for r, data := range records {
+		if len(data.SectionTree) == 0 {
+			for s, sec := range data.Sections {
+				for i, p := range sec.Paragraphs {
+					units = append(units, paragraphUnit{record: r, section: s, index: i, path: []string{sec.Title}, text: strings.TrimSpace(p)})
+				}
+			}
+			continue
+		}
+		s := 0
+		var walk func(sec *Section, path []string)
+		walk = func(sec *Section, path []string) {
+			path = append(path[:len(path):len(path)], sec.Title)
+			for i, p := range sec.Paragraphs {
+				text := p.CleanText
+				if text == "" {
+					text = strings.TrimSpace(p.Text)
+				}
+				units = append(units, paragraphUnit{record: r, section: s, index: i, path: path, text: text})
+			}
+			s++
+			for _, child := range sec.Children {
+				walk(child, path)
+			}
+		}
+		for _, sec := range data.SectionTree {
+			walk(sec, nil)
+		}
+	}
+	return units
+}
+
+// shingles returns the hashes of the k-word shingles of text. Texts of
+// fewer than k words are a single shingle.
+func shingles(words []string, k int) map[uint64]bool {
+	set := map[uint64]bool{}
+	if len(words) < k {
+		k = len(words)
+	}
+	for i := 0; i+k <= len(words); i++ {
+		h := fnv.New64a()
+		h.Write([]byte(strings.Join(words[i:i+k], " ")))
+		set[h.Sum64()] = true
+	}
+	return set
+}
+
+// jaccard returns the Jaccard similarity of two shingle sets.
+func jaccard(a, b map[uint64]bool) float64 {
+	if len(a) == 0 && len(b) == 0 {
+		return 1
+	}
+	shared := 0
+	for h := range a {
+		if b[h] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(a)+len(b)-shared)
+}
+
+// mix is the splitmix64 finalizer. Combined with a different seed per
+// position, it stands in for a family of random hash functions.
+func mix(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// minHash returns the MinHash signature of a shingle set.
+func minHash(set map[uint64]bool, n int) []uint64 {
+	sig := make([]uint64, n)
+	for i := range sig {
+		sig[i] = math.MaxUint64
+	}
+	for h := range set {
+		for i := range sig {
+			if v := mix(h ^ mix(uint64(i)+1)); v < sig[i] {
+				sig[i] = v
+			}
+		}
+	}
+	return sig
+}
+
+// lshBands splits a signature of n hashes into bands of rows. Two sets
+// of similarity s share a band with probability 1-(1-s^rows)^bands,
+// which rises steeply around (1/bands)^(1/rows). The most rows are used
+// that keep that point 0.1 below the threshold, so pairs at the
+// threshold are found almost surely while few dissimilar pairs collide.
+func lshBands(threshold float64, n int) (bands, rows int) {
+	bands, rows = n, 1
+	for r := 2; r <= n; r++ {
+		b := n / r
+		if math.Pow(1/float64(b), 1/float64(r)) > threshold-0.1 {
+			break
+		}
+		bands, rows = b, r
+	}
+	return bands, rows
+}
+
+// findDuplicates groups the paragraphs of records into clusters of near
+// duplicates. Candidate pairs come from MinHash LSH and are kept when the
+// exact Jaccard similarity of their shingles reaches the threshold. Pairs
+// are joined transitively. Clusters and their members are in document
+// order.
+func findDuplicates(records []WebsiteData, opts dedupOptions) ([]paragraphUnit, [][]int) {
+	units := paragraphUnits(records)
+	var eligible []int
+	for i := range units {
+		words := tokenize(units[i].text)
+		if len(words) < opts.minWords {
+			continue
+		}
+		units[i].shingles = shingles(words, opts.shingle)
+		eligible = append(eligible, i)
+	}
+
+	bands, rows := lshBands(opts.threshold, opts.hashes)
+	buckets := map[uint64][]int{}
+	for _, i := range eligible {
+		sig := minHash(units[i].shingles, bands*rows)
+		for b := 0; b < bands; b++ {
+			h := fnv.New64a()
+			fmt.Fprint(h, b, sig[b*rows:(b+1)*rows])
+			key := h.Sum64()
+			buckets[key] = append(buckets[key], i)
+		}
+	}
+
+	parent := map[int]int{}
+	var find func(i int) int
+	find = func(i int) int {
+		p, ok := parent[i]
+		if !ok || p == i {
+			return i
+		}
+		root := find(p)
+		parent[i] = root
+		return root
+	}
+	checked := map[[2]int]bool{}
+	for _, bucket := range buckets {
+		for x := 0; x < len(bucket); x++ {
+			for y := x + 1; y < len(bucket); y++ {
+				pair := [2]int{bucket[x], bucket[y]}
+				if checked[pair] {
+					continue
+				}
+				checked[pair] = true
+				if jaccard(units[pair[0]].shingles, units[pair[1]].shingles) < opts.threshold {
+					continue
+				}
+				// The earlier paragraph becomes the root, so every root is
+				// the first occurrence of its cluster.
+				a, b := find(pair[0]), find(pair[1])
+				if a > b {
+					a, b = b, a
+				}
+				if a != b {
+					parent[b] = a
+				}
+			}
+		}
+	}
+
+	members := map[int][]int{}
+	for _, i := range eligible {
+		root := find(i)
+		members[root] = append(members[root], i)
+	}
+	var clusters [][]int
+	for _, m := range members {
+		if len(m) < 2 {
+			continue
+		}
+		sort.Ints(m)
+		clusters = append(clusters, m)
+	}
+	sort.Slice(clusters, func(i, j int) bool { return clusters[i][0] < clusters[j][0] })
+	return units, clusters
+}
+
+// describeClusters turns clusters of unit indexes into report entries.
+func describeClusters(records []WebsiteData, units []paragraphUnit, clusters [][]int) []DuplicateCluster {
+	var out []DuplicateCluster
+	for _, members := range clusters {
+		first := units[members[0]]
+		var c DuplicateCluster
+		for _, i := range members {
+			u := units[i]
+			c.Paragraphs = append(c.Paragraphs, DuplicateParagraph{
+				URL:        records[u.record].URL,
+				Title:      records[u.record].Title,
+				Section:    strings.Join(u.path, " > "),
+				Index:      u.index,
+				Similarity: math.Round(jaccard(first.shingles, u.shingles)*1000) / 1000,
+				Text:       u.text,
+			})
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// dedupRecords returns copies of records without the paragraphs that
+// repeat an earlier member of their cluster. They are removed from the
+// ordered sections and from the section tree alike.
+func dedupRecords(records []WebsiteData, units []paragraphUnit, clusters [][]int) []WebsiteData {
+	type position struct{ section, index int }
+	drop := map[int]map[position]bool{}
+	for _, members := range clusters {
+		for _, i := range members[1:] {
+			u := units[i]
+			if drop[u.record] == nil {
+				drop[u.record] = map[position]bool{}
+			}
+			drop[u.record][position{u.section, u.index}] = true
+		}
+	}
+
+	out := make([]WebsiteData, len(records))
+	for r, data := range records {
+		out[r] = data
+		gone := drop[r]
+		if len(gone) == 0 {
+			continue
+		}
+
+		sections := make([]SectionRecord, len(data.Sections))
+		for s, sec := range data.Sections {
+			sec.Paragraphs = append([]string{}, sec.Paragraphs...)
+			kept := sec.Paragraphs[:0]
+			for i, p := range sec.Paragraphs {
+				if !gone[position{s, i}] {
+					kept = append(kept, p)
+				}
+			}
+			sec.Paragraphs = kept
+			sections[s] = sec
+		}
+		out[r].Sections = sections
+
+		s := 0
+		var copyTree func(secs []*Section) []*Section
+		copyTree = func(secs []*Section) []*Section {
+			var copied []*Section
+			for _, sec := range secs {
+				c := *sec
+				c.Paragraphs = []Paragraph{}
+				for i, p := range sec.Paragraphs {
+					if !gone[position{s, i}] {
+						c.Paragraphs = append(c.Paragraphs, p)
+					}
+				}
+				s++
+				c.Children = copyTree(sec.Children)
+				copied = append(copied, &c)
+			}
+			return copied
+		}
+		if data.SectionTree != nil {
+			out[r].SectionTree = copyTree(data.SectionTree)
+		}
+	}
+	return out
+}
+
+// runDedup implements the "dedup" command, which reports near-duplicate
+// paragraphs and can write a corpus without them.
+func runDedup(args []string) int {
+	fs := flag.NewFlagSet("dedup", flag.ExitOnError)
+	input := fs.String("input", "wikipedia_data.jsonl", "scraped JSON lines file")
+	report := fs.String("report", "duplicates.jsonl", "JSON lines file with one duplicate cluster per line")
+	output := fs.String("output", "", "write the records without repeated paragraphs to this JSON lines file (disabled when empty)")
+	threshold := fs.Float64("threshold", 0.8, "minimum Jaccard similarity of the word shingles of two paragraphs, between 0 and 1")
+	shingle := fs.Int("shingle", 3, "words per shingle")
+	minWords := fs.Int("min-words", 8, "ignore paragraphs with fewer words")
+	fs.Parse(args)
+
+	if *threshold <= 0 || *threshold > 1 {
+		fmt.Println("Error: -threshold must be between 0 and 1")
+		return 2
+	}
+	if *shingle < 1 {
+		fmt.Println("Error: -shingle must be at least 1")
+		return 2
+	}
+
+	records, err := readRecords(*input)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	opts := dedupOptions{threshold: *threshold, shingle: *shingle, minWords: *minWords, hashes: 128}
+	units, clusters := findDuplicates(records, opts)
+	described := describeClusters(records, units, clusters)
+
+	if err := writeJSONLFile(*report, described); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	repeated := 0
+	for _, c := range described {
+		repeated += len(c.Paragraphs) - 1
+	}
+	fmt.Printf("%d paragraphs in %d articles: %d duplicate clusters, %d repeated paragraphs\n", len(units), len(records), len(described), repeated)
+	for _, c := range described {
+		first := c.Paragraphs[0]
+		fmt.Printf("- %d copies of %q\n", len(c.Paragraphs), snippet(first.Text, 60))
+		for _, p := range c.Paragraphs {
+			fmt.Printf("    %.3f  %s (%s)\n", p.Similarity, p.Title, p.Section)
+		}
+	}
+	fmt.Printf("Clusters written to %s\n", *report)
+
+	if *output != "" {
+		if err := writeJSONLFile(*output, dedupRecords(records, units, clusters)); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		}
+		fmt.Printf("Deduplicated corpus written to %s\n", *output)
+	}
+	return 0
+}
+
+// snippet shortens text to at most n runes for display.
+func snippet(text string, n int) string {
+	runes := []rune(text)
+	if len(runes) <= n {
+		return text
+	}
+	return string(runes[:n]) + "..."
+}
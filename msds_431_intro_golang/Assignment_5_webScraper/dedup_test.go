@@ -0,0 +1,200 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const (
+	boilerplate = "Robotics is the interdisciplinary study and practice of the design, construction, operation, and use of robots. " +
+		"Within mechanical engineering, robotics is the design and construction of the physical structures of robots, " +
+		"while in computer science it focuses on robotic automation algorithms."
+	// One word of boilerplate changed.
+	nearBoilerplate = "Robotics is the interdisciplinary study and practice of the design, construction, operation, and use of robots. " +
+		"Within mechanical engineering, robotics is the design and construction of the mechanical structures of robots, " +
+		"while in computer science it focuses on robotic automation algorithms."
+)
+
+// treeRecord returns a record with the given top level sections and the
+// matching ordered sections.
+func treeRecord(pageURL, title string, sections ...*Section) WebsiteData {
+	data := WebsiteData{SchemaVersion: SchemaVersion, URL: pageURL, Title: title, SectionTree: sections}
+	var walk func(secs []*Section)
+	walk = func(secs []*Section) {
+		for _, sec := range secs {
+			rec := SectionRecord{Title: sec.Title, Level: sec.Level, Paragraphs: []string{}}
+			for _, p := range sec.Paragraphs {
+				rec.Paragraphs = append(rec.Paragraphs, p.Text)
+			}
+			data.Sections = append(data.Sections, rec)
+			walk(sec.Children)
+		}
+	}
+	walk(sections)
+	return data
+}
+
+func section(title string, level int, texts ...string) *Section {
+	sec := &Section{Title: title, Level: level, Paragraphs: []Paragraph{}}
+	for _, text := range texts {
+		sec.Paragraphs = append(sec.Paragraphs, Paragraph{Text: text + "[1]", CleanText: text})
+	}
+	return sec
+}
+
+func dedupCorpus() []WebsiteData {
+	history := section("History", 2, "The first industrial robot, Unimate, was installed on a General Motors assembly line in 1961 to move hot die-cast parts.")
+	history.Children = []*Section{section("Early automata", 3, boilerplate)}
+	return []WebsiteData{
+		treeRecord("https://en.wikipedia.org/wiki/Robotics", "Robotics",
+			section("main_summary", 1, boilerplate, "See also."),
+			history),
+		treeRecord("https://en.wikipedia.org/wiki/Robot", "Robot",
+			section("main_summary", 1, "A robot is a machine that can carry out a complex series of actions automatically, especially one programmed by a computer."),
+			section("Overview", 2, nearBoilerplate, "See also.")),
+	}
+}
+
+func TestShinglesAndJaccard(t *testing.T) {
+	a := shingles(tokenize(boilerplate), 3)
+	b := shingles(tokenize(nearBoilerplate), 3)
+	// "robotics is the" and a few other shingles occur twice.
+	if n := len(tokenize(boilerplate)); len(a) == 0 || len(a) > n-2 {
+		t.Errorf("got %d shingles for %d words, want at most %d", len(a), n, n-2)
+	}
+	if s := jaccard(a, a); s != 1 {
+		t.Errorf("jaccard of a set with itself = %g, want 1", s)
+	}
+	if s := jaccard(a, b); s < 0.8 || s > 0.95 {
+		t.Errorf("jaccard of near duplicates = %g, want between 0.8 and 0.95", s)
+	}
+	if got := shingles([]string{"see", "also"}, 3); len(got) != 1 {
+		t.Errorf("short text has %d shingles, want 1", len(got))
+	}
+
+	// The share of equal MinHash values estimates the Jaccard similarity.
+	sa, sb := minHash(a, 256), minHash(b, 256)
+	equal := 0
+	for i := range sa {
+		if sa[i] == sb[i] {
+			equal++
+		}
+	}
+	if est, exact := float64(equal)/256, jaccard(a, b); est < exact-0.1 || est > exact+0.1 {
+		t.Errorf("MinHash estimate %g is far from the Jaccard similarity %g", est, exact)
+	}
+}
+
+func TestLSHBands(t *testing.T) {
+	for _, threshold := range []float64{0.5, 0.8, 0.95} {
+		bands, rows := lshBands(threshold, 128)
+		if bands*rows > 128 || bands < 1 || rows < 1 {
+			t.Errorf("lshBands(%g) = %d bands of %d rows", threshold, bands, rows)
+		}
+	}
+	if _, rows := lshBands(0.95, 128); rows <= 2 {
+		t.Errorf("a high threshold uses %d rows per band, want more", rows)
+	}
+}
+
+func TestFindDuplicates(t *testing.T) {
+	records := dedupCorpus()
+	opts := dedupOptions{threshold: 0.8, shingle: 3, minWords: 8, hashes: 128}
+	units, clusters := findDuplicates(records, opts)
+	described := describeClusters(records, units, clusters)
+
+	if len(described) != 1 {
+		t.Fatalf("got %d clusters, want 1: %+v", len(described), described)
+	}
+	var got []string
+	for _, p := range described[0].Paragraphs {
+		got = append(got, p.Title+": "+p.Section)
+	}
+	want := []string{"Robotics: main_summary", "Robotics: History > Early automata", "Robot: Overview"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("cluster = %q, want %q", got, want)
+	}
+	if first := described[0].Paragraphs[0]; first.Similarity != 1 || first.Text != boilerplate {
+		t.Errorf("first member = %+v", first)
+	}
+	if last := described[0].Paragraphs[2]; last.Similarity >= 1 || last.Similarity < 0.8 {
+		t.Errorf("near duplicate similarity = %g", last.Similarity)
+	}
+
+	opts.threshold = 0.99
+	if _, clusters := findDuplicates(records, opts); len(clusters) != 1 || len(clusters[0]) != 2 {
+		t.Errorf("at 0.99 got clusters %v, want only the exact copies", clusters)
+	}
+}
+
+func TestDedupRecords(t *testing.T) {
+	records := dedupCorpus()
+	units, clusters := findDuplicates(records, dedupOptions{threshold: 0.8, shingle: 3, minWords: 8, hashes: 128})
+	deduped := dedupRecords(records, units, clusters)
+
+	robotics, robot := deduped[0], deduped[1]
+	if got := robotics.Sections[0].Paragraphs; len(got) != 2 {
+		t.Errorf("lead of the first article lost paragraphs: %q", got)
+	}
+	if got := robotics.Sections[2].Paragraphs; len(got) != 0 {
+		t.Errorf("repeated paragraph kept in Early automata: %q", got)
+	}
+	if got := robotics.SectionTree[1].Children[0].Paragraphs; len(got) != 0 {
+		t.Errorf("repeated paragraph kept in the tree: %+v", got)
+	}
+	if got := robot.Sections[1].Paragraphs; !reflect.DeepEqual(got, []string{"See also.[1]"}) {
+		t.Errorf("Robot overview = %q, want only the short paragraph", got)
+	}
+	if got := robot.SectionTree[1].Paragraphs; len(got) != 1 {
+		t.Errorf("Robot overview tree has %d paragraphs, want 1", len(got))
+	}
+
+	// The input records are not modified.
+	if len(records[1].Sections[1].Paragraphs) != 2 || len(records[1].SectionTree[1].Paragraphs) != 2 {
+		t.Error("dedupRecords modified its input")
+	}
+	for _, data := range deduped {
+		if issues := checkRecord(data); len(issues) > 0 {
+			t.Errorf("%s: %v", data.URL, issues)
+		}
+	}
+}
+
+func TestRunDedup(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "data.jsonl")
+	var lines []string
+	for _, data := range dedupCorpus() {
+		lines = append(lines, mustJSON(t, data))
+	}
+	if err := os.WriteFile(input, []byte(strings.Join(lines, "\n")+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	report := filepath.Join(dir, "duplicates.jsonl")
+	output := filepath.Join(dir, "deduped.jsonl")
+	if code := runDedup([]string{"-input", input, "-report", report, "-output", output}); code != 0 {
+		t.Fatalf("runDedup returned %d", code)
+	}
+	raw, err := os.ReadFile(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(raw), "\n"); n != 1 {
+		t.Errorf("report has %d clusters, want 1", n)
+	}
+	records, err := readRecords(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || len(records[1].Sections[1].Paragraphs) != 1 {
+		t.Errorf("deduplicated corpus = %+v", records)
+	}
+
+	if code := runDedup([]string{"-input", input, "-threshold", "1.5"}); code != 2 {
+		t.Errorf("runDedup with -threshold 1.5 returned %d, want 2", code)
+	}
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// ArticleDiff describes how one article changed between two scrapes.
+// Status is "added", "removed", "modified" or "unchanged". Similarity is
+// 1 for identical text and 0 for text with no words in common.
+type ArticleDiff struct {
+	URL         string        `json:"url"`
+	Title       string        `json:"title"`
+	Status      string        `json:"status"`
+	Similarity  float64       `json:"similarity"`
+	Substantial bool          `json:"substantial"`
+	Sections    []SectionDiff `json:"sections,omitempty"`
+}
+
+// SectionDiff describes a section that was added, removed or modified.
+// Unchanged sections are not listed.
+type SectionDiff struct {
+	Path       []string          `json:"path"`
+	Status     string            `json:"status"`
+	Similarity float64           `json:"similarity"`
+	Paragraphs []ParagraphChange `json:"paragraphs,omitempty"`
+}
+
+// ParagraphChange is a paragraph that is only in the old ("removed") or
+// only in the new ("added") version of a section.
+type ParagraphChange struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
+
+// counts returns the number of added, removed and modified sections.
+func (d ArticleDiff) counts() (added, removed, modified int) {
+	for _, s := range d.Sections {
+		switch s.Status {
+		case "added":
+			added++
+		case "removed":
+			removed++
+		case "modified":
+			modified++
+		}
+	}
+	return added, removed, modified
+}
+
+// keyedSection is a section with a key that identifies it within its
+// article: the section path, plus a counter for repeated paths.
+type keyedSection struct {
+	key string
+	sectionText
+}
+
+func keySections(data WebsiteData) []keyedSection {
+	seen := map[string]int{}
+	var out []keyedSection
+	for _, sec := range sectionTexts(data) {
+		path := strings.Join(sec.Path, " > ")
+		seen[path]++
+		out = append(out, keyedSection{key: fmt.Sprintf("%s#%d", path, seen[path]), sectionText: sec})
+	}
+	return out
+}
+
+// diffRecords compares two scrapes article by article, matching articles
+// by URL and sections by their path. Articles whose similarity is below
+// threshold are marked as substantial changes. The result is sorted by
+// URL.
+func diffRecords(oldRecords, newRecords []WebsiteData, threshold float64) []ArticleDiff {
+	oldByURL := map[string]WebsiteData{}
+	for _, data := range oldRecords {
+		oldByURL[data.URL] = data
+	}
+	newByURL := map[string]WebsiteData{}
+	for _, data := range newRecords {
+		newByURL[data.URL] = data
+	}
+
+	var urls []string
+	for u := range oldByURL {
+		urls = append(urls, u)
+	}
+	for u := range newByURL {
+		if _, ok := oldByURL[u]; !ok {
+			urls = append(urls, u)
+		}
+	}
+	sort.Strings(urls)
+
+	var diffs []ArticleDiff
+	for _, u := range urls {
+		oldData, inOld := oldByURL[u]
+		newData, inNew := newByURL[u]
+		var d ArticleDiff
+		switch {
+		case !inOld:
+			d = ArticleDiff{URL: u, Title: newData.Title, Status: "added"}
+		case !inNew:
+			d = ArticleDiff{URL: u, Title: oldData.Title, Status: "removed"}
+		default:
+			d = diffArticle(oldData, newData)
+		}
+		d.Substantial = d.Similarity < threshold
+		diffs = append(diffs, d)
+	}
+	return diffs
+}
+
+// diffArticle compares two versions of an article. The article similarity
+// is the average of the section similarities weighted by their length in
+// words, with added and removed sections counting as 0.
+func diffArticle(oldData, newData WebsiteData) ArticleDiff {
+	d := ArticleDiff{URL: newData.URL, Title: newData.Title, Status: "unchanged"}
+
+	oldSections := map[string]sectionText{}
+	var oldOrder []string
+	for _, sec := range keySections(oldData) {
+		oldSections[sec.key] = sec.sectionText
+		oldOrder = append(oldOrder, sec.key)
+	}
+
+	var weighted, total float64
+	matched := map[string]bool{}
+	for _, sec := range keySections(newData) {
+		words := float64(len(strings.Fields(strings.Join(sec.Paragraphs, " "))))
+		old, ok := oldSections[sec.key]
+		if !ok {
+			total += words
+			d.Sections = append(d.Sections, SectionDiff{Path: sec.Path, Status: "added", Paragraphs: paragraphChanges(nil, sec.Paragraphs)})
+			continue
+		}
+		matched[sec.key] = true
+		oldWords := float64(len(strings.Fields(strings.Join(old.Paragraphs, " "))))
+		sim := textSimilarity(old.Paragraphs, sec.Paragraphs)
+		weighted += sim * (words + oldWords) / 2
+		total += (words + oldWords) / 2
+		if changes := paragraphChanges(old.Paragraphs, sec.Paragraphs); len(changes) > 0 {
+			d.Sections = append(d.Sections, SectionDiff{Path: sec.Path, Status: "modified", Similarity: sim, Paragraphs: changes})
+		}
+	}
+	for _, key := range oldOrder {
+		if matched[key] {
+			continue
+		}
+		old := oldSections[key]
+		total += float64(len(strings.Fields(strings.Join(old.Paragraphs, " "))))
+		d.Sections = append(d.Sections, SectionDiff{Path: old.Path, Status: "removed", Paragraphs: paragraphChanges(old.Paragraphs, nil)})
+	}
+
+	d.Similarity = 1
+	if total > 0 {
+		d.Similarity = weighted / total
+	}
+	if len(d.Sections) > 0 {
+		d.Status = "modified"
+	}
+	return d
+}
+
+// paragraphChanges lists the paragraphs that were removed from or added to
+// a section, in document order, using the longest common subsequence of
+// the two paragraph lists.
+func paragraphChanges(oldParas, newParas []string) []ParagraphChange {
+	lcs := lcsTable(oldParas, newParas)
+	var changes []ParagraphChange
+	i, j := 0, 0
+	for i < len(oldParas) || j < len(newParas) {
+		switch {
+		case i < len(oldParas) && j < len(newParas) && oldParas[i] == newParas[j]:
+			i++
+			j++
+		case i < len(oldParas) && (j == len(newParas) || lcs[i+1][j] >= lcs[i][j+1]):
+			changes = append(changes, ParagraphChange{Op: "removed", Text: oldParas[i]})
+			i++
+		default:
+			changes = append(changes, ParagraphChange{Op: "added", Text: newParas[j]})
+			j++
+		}
+	}
+	return changes
+}
+
+// lcsTable returns t where t[i][j] is the length of the longest common
+// subsequence of a[i:] and b[j:].
+func lcsTable(a, b []string) [][]int {
+	t := make([][]int, len(a)+1)
+	for i := range t {
+		t[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				t[i][j] = t[i+1][j+1] + 1
+			} else {
+				t[i][j] = max(t[i+1][j], t[i][j+1])
+			}
+		}
+	}
+	return t
+}
+
+// textSimilarity compares two texts word by word: twice the length of
+// their longest common subsequence of words divided by the total number
+// of words, as difflib's ratio does for characters.
+func textSimilarity(oldParas, newParas []string) float64 {
+	a := strings.Fields(strings.Join(oldParas, " "))
+	b := strings.Fields(strings.Join(newParas, " "))
+	if len(a)+len(b) == 0 {
+		return 1
+	}
+	// Two rows are enough for the length alone.
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				cur[j] = prev[j+1] + 1
+			} else {
+				cur[j] = max(prev[j], cur[j+1])
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return 2 * float64(prev[0]) / float64(len(a)+len(b))
+}
+
+// writeDiffSummary prints one row per changed article, followed by totals.
+func writeDiffSummary(w io.Writer, diffs []ArticleDiff) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ARTICLE\tSTATUS\tSIMILARITY\t+SECTIONS\t-SECTIONS\t~SECTIONS\t")
+	statuses := map[string]int{}
+	substantial := 0
+	for _, d := range diffs {
+		statuses[d.Status]++
+		if d.Substantial {
+			substantial++
+		}
+		if d.Status == "unchanged" {
+			continue
+		}
+		added, removed, modified := d.counts()
+		status := d.Status
+		if d.Substantial {
+			status += " (!)"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%.3f\t%d\t%d\t%d\t\n", d.Title, status, d.Similarity, added, removed, modified)
+	}
+	tw.Flush()
+	fmt.Fprintf(w, "\n%d articles: %d added, %d removed, %d modified, %d unchanged; %d substantial changes\n",
+		len(diffs), statuses["added"], statuses["removed"], statuses["modified"], statuses["unchanged"], substantial)
+}
+
+// runDiff implements the "diff" command, which compares two scrapes.
+func runDiff(args []string) int {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	oldFile := fs.String("old", "", "earlier scrape (JSON lines)")
+	newFile := fs.String("new", "wikipedia_data.jsonl", "later scrape (JSON lines)")
+	output := fs.String("output", "diff.jsonl", "JSON lines file for the per-article changes")
+	threshold := fs.Float64("threshold", 0.8, "articles with a similarity below this are substantial changes")
+	exitCode := fs.Bool("exit-code", false, "exit with status 1 when there are substantial changes")
+	fs.Parse(args)
+
+	if *oldFile == "" {
+		fmt.Println("Usage: diff -old earlier.jsonl [-new later.jsonl] [-output diff.jsonl]")
+		return 2
+	}
+	oldRecords, err := readRecords(*oldFile)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	newRecords, err := readRecords(*newFile)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+
+	diffs := diffRecords(oldRecords, newRecords, *threshold)
+
+	if err := writeJSONLFile(*output, diffs); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	substantial := false
+	for _, d := range diffs {
+		substantial = substantial || d.Substantial
+	}
+
+	writeDiffSummary(os.Stdout, diffs)
+	fmt.Printf("Changes written to %s\n", *output)
+	if *exitCode && substantial {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func article(url string, sections ...SectionRecord) WebsiteData {
+	return WebsiteData{SchemaVersion: SchemaVersion, URL: url, Title: url, Sections: sections}
+}
+
+func TestParagraphChanges(t *testing.T) {
+	tests := []struct {
+		old, new []string
+		want     []ParagraphChange
+	}{
+		{[]string{"a", "b"}, []string{"a", "b"}, nil},
+		{[]string{"a", "b", "c"}, []string{"a", "c"}, []ParagraphChange{{"removed", "b"}}},
+		{[]string{"a"}, []string{"a", "b"}, []ParagraphChange{{"added", "b"}}},
+		{[]string{"a", "b", "c"}, []string{"a", "x", "c"}, []ParagraphChange{{"removed", "b"}, {"added", "x"}}},
+	}
+	for _, tt := range tests {
+		if got := paragraphChanges(tt.old, tt.new); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("paragraphChanges(%v, %v) = %v, want %v", tt.old, tt.new, got, tt.want)
+		}
+	}
+}
+
+func TestTextSimilarity(t *testing.T) {
+	tests := []struct {
+		old, new []string
+		want     float64
+	}{
+		{[]string{"the robot moves"}, []string{"the robot moves"}, 1},
+		{[]string{"the robot moves"}, []string{"a cat sleeps"}, 0},
+		{[]string{"the robot moves fast"}, []string{"the robot moves"}, 6.0 / 7},
+		{nil, nil, 1},
+	}
+	for _, tt := range tests {
+		if got := textSimilarity(tt.old, tt.new); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("textSimilarity(%v, %v) = %v, want %v", tt.old, tt.new, got, tt.want)
+		}
+	}
+}
+
+func TestDiffRecords(t *testing.T) {
+	lead := SectionRecord{Title: "main_summary", Level: 1, Paragraphs: []string{"Robots are machines."}}
+	oldRecords := []WebsiteData{
+		article("https://en.wikipedia.org/wiki/Robot", lead,
+			SectionRecord{Title: "History", Level: 2, Paragraphs: []string{"Early robots were simple.", "They were slow."}},
+			SectionRecord{Title: "Trivia", Level: 2, Paragraphs: []string{"Removed later."}}),
+		article("https://en.wikipedia.org/wiki/Chatbot", lead),
+		article("https://en.wikipedia.org/wiki/Gone", lead),
+	}
+	newRecords := []WebsiteData{
+		article("https://en.wikipedia.org/wiki/Robot", lead,
+			SectionRecord{Title: "History", Level: 2, Paragraphs: []string{"Early robots were simple.", "They were fast."}},
+			SectionRecord{Title: "Uses", Level: 2, Paragraphs: []string{"Factories."}}),
+		article("https://en.wikipedia.org/wiki/Chatbot", lead),
+		article("https://en.wikipedia.org/wiki/New", lead),
+	}
+
+	diffs := diffRecords(oldRecords, newRecords, 0.8)
+	status := map[string]string{}
+	for _, d := range diffs {
+		status[strings.TrimPrefix(d.URL, "https://en.wikipedia.org/wiki/")] = d.Status
+	}
+	want := map[string]string{"Chatbot": "unchanged", "Gone": "removed", "New": "added", "Robot": "modified"}
+	if !reflect.DeepEqual(status, want) {
+		t.Errorf("statuses = %v, want %v", status, want)
+	}
+
+	var robot ArticleDiff
+	for _, d := range diffs {
+		if strings.HasSuffix(d.URL, "/Robot") {
+			robot = d
+		}
+	}
+	var sections []string
+	for _, s := range robot.Sections {
+		sections = append(sections, s.Status+" "+strings.Join(s.Path, " > "))
+	}
+	wantSections := []string{"modified History", "added Uses", "removed Trivia"}
+	if !reflect.DeepEqual(sections, wantSections) {
+		t.Errorf("sections = %v, want %v", sections, wantSections)
+	}
+	wantChanges := []ParagraphChange{{"removed", "They were slow."}, {"added", "They were fast."}}
+	if !reflect.DeepEqual(robot.Sections[0].Paragraphs, wantChanges) {
+		t.Errorf("History changes = %v, want %v", robot.Sections[0].Paragraphs, wantChanges)
+	}
+	if robot.Similarity <= 0 || robot.Similarity >= 1 {
+		t.Errorf("similarity = %v, want between 0 and 1", robot.Similarity)
+	}
+
+	for _, d := range diffs {
+		if wantSubstantial := d.Status != "unchanged" && d.Similarity < 0.8; d.Substantial != wantSubstantial {
+			t.Errorf("%s: substantial = %v, want %v", d.URL, d.Substantial, wantSubstantial)
+		}
+	}
+
+	var summary bytes.Buffer
+	writeDiffSummary(&summary, diffs)
+	if !strings.Contains(summary.String(), "4 articles: 1 added, 1 removed, 1 modified, 1 unchanged") {
+		t.Errorf("summary = %s", summary.String())
+	}
+}
+
+func TestRunDiffExitCode(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, records ...WebsiteData) string {
+		var buf bytes.Buffer
+		for _, data := range records {
+			line, _ := json.Marshal(data)
+			buf.Write(line)
+			buf.WriteString("\n")
+		}
+		file := filepath.Join(dir, name)
+		if err := os.WriteFile(file, buf.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return file
+	}
+	lead := SectionRecord{Title: "main_summary", Level: 1, Paragraphs: []string{"Robots are machines."}}
+	oldFile := write("old.jsonl", article("u1", lead))
+	sameFile := write("same.jsonl", article("u1", lead))
+	changedFile := write("changed.jsonl", article("u1", SectionRecord{Title: "main_summary", Level: 1, Paragraphs: []string{"Completely different text."}}))
+	out := filepath.Join(dir, "diff.jsonl")
+
+	if code := runDiff([]string{"-old", oldFile, "-new", sameFile, "-output", out, "-exit-code"}); code != 0 {
+		t.Errorf("exit code for identical scrapes = %d, want 0", code)
+	}
+	if code := runDiff([]string{"-old", oldFile, "-new", changedFile, "-output", out, "-exit-code"}); code != 1 {
+		t.Errorf("exit code for a substantial change = %d, want 1", code)
+	}
+	records, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var d ArticleDiff
+	if err := json.Unmarshal(bytes.TrimSpace(records), &d); err != nil {
+		t.Fatal(err)
+	}
+	if d.Status != "modified" || !d.Substantial || d.Similarity != 0 {
+		t.Errorf("diff = %+v", d)
+	}
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// epubOptions describes the book written by writeEPUB.
+type epubOptions struct {
+	title    string
+	language string    // used when the first record has no language; empty means "en"
+	modified time.Time // the dcterms:modified date; zero means now
+}
+
+// tocEntry is one entry of the EPUB table of contents.
+type tocEntry struct {
+	Title    string
+	Href     string
+	Children []*tocEntry
+}
+
+// epubChapter renders an article as an XHTML document and returns it with
+// the table of contents entry for it, which lists its sections.
+func epubChapter(data WebsiteData, href, language string) (string, *tocEntry) {
+	if data.Language != "" {
+		language = data.Language
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xml:lang="%[1]s" lang="%[1]s">
+<head>
+<meta charset="UTF-8"/>
+<title>%[2]s</title>
+</head>
+<body>
+<h1>%[2]s</h1>
+<p class="source">Source: <a href="%[3]s">%[3]s</a></p>
+`, xmlText(language), xmlText(data.Title), xmlText(data.URL))
+
+	entry := &tocEntry{Title: data.Title, Href: href}
+	// open holds the entries of the sections that later, deeper sections
+	// nest under; open[0] is the article itself.
+	open := []*tocEntry{entry}
+	levels := []int{1}
+	for i, sec := range sectionTexts(data) {
+		if sec.Level > 1 {
+			id := fmt.Sprintf("section%d", i)
+			level := min(sec.Level, 6)
+			fmt.Fprintf(&b, "<h%d id=\"%s\">%s</h%d>\n", level, id, xmlText(sec.Title()), level)
+
+			for len(levels) > 1 && levels[len(levels)-1] >= sec.Level {
+				open, levels = open[:len(open)-1], levels[:len(levels)-1]
+			}
+			child := &tocEntry{Title: sec.Title(), Href: href + "#" + id}
+			parent := open[len(open)-1]
+			parent.Children = append(parent.Children, child)
+			open, levels = append(open, child), append(levels, sec.Level)
+		}
+		for _, p := range sec.Paragraphs {
+			fmt.Fprintf(&b, "<p>%s</p>\n", xmlText(p))
+		}
+		for _, block := range sec.Blocks {
+			switch {
+			case block.Type == "blockquote":
+				fmt.Fprintf(&b, "<blockquote><p>%s</p></blockquote>\n", xmlText(block.Text))
+			case len(block.Items) > 0:
+				tag := "ul"
+				if block.Ordered {
+					tag = "ol"
+				}
+				fmt.Fprintf(&b, "<%s>\n", tag)
+				for _, item := range block.Items {
+					fmt.Fprintf(&b, "<li>%s</li>\n", xmlText(item))
+				}
+				fmt.Fprintf(&b, "</%s>\n", tag)
+			}
+		}
+		for _, t := range sec.Tables {
+			caption := "Table"
+			if t.Caption != "" {
+				caption += ": " + t.Caption
+			}
+			fmt.Fprintf(&b, "<p class=\"table\"><em>%s</em> (%s)</p>\n", xmlText(caption), xmlText(filepath.ToSlash(t.CSV)))
+		}
+	}
+	b.WriteString("</body>\n</html>\n")
+	return b.String(), entry
+}
+
+// writeNav writes the entries as nested ordered lists for nav.xhtml.
+func writeNav(b *strings.Builder, entries []*tocEntry, indent string) {
+	fmt.Fprintf(b, "%s<ol>\n", indent)
+	for _, e := range entries {
+		fmt.Fprintf(b, "%s  <li><a href=\"%s\">%s</a>", indent, xmlText(e.Href), xmlText(e.Title))
+		if len(e.Children) > 0 {
+			b.WriteString("\n")
+			writeNav(b, e.Children, indent+"    ")
+			b.WriteString(indent + "  ")
+		}
+		b.WriteString("</li>\n")
+	}
+	fmt.Fprintf(b, "%s</ol>\n", indent)
+}
+
+// writeNavPoints writes the entries as nested navPoints for toc.ncx,
+// which e-readers without EPUB 3 support use. next numbers the points.
+func writeNavPoints(b *strings.Builder, entries []*tocEntry, indent string, next *int) {
+	for _, e := range entries {
+		*next++
+		fmt.Fprintf(b, "%s<navPoint id=\"nav%d\" playOrder=\"%d\"><navLabel><text>%s</text></navLabel><content src=\"%s\"/>\n",
+			indent, *next, *next, xmlText(e.Title), xmlText(e.Href))
+		writeNavPoints(b, e.Children, indent+"  ", next)
+		fmt.Fprintf(b, "%s</navPoint>\n", indent)
+	}
+}
+
+// writeEPUB bundles the articles into an EPUB 3 book with one chapter per
+// article. The table of contents lists the articles and their sections,
+// both as nav.xhtml and, for older readers, as toc.ncx.
+func writeEPUB(w io.Writer, records []WebsiteData, opts epubOptions) error {
+	language := opts.language
+	if len(records) > 0 && records[0].Language != "" {
+		language = records[0].Language
+	}
+	if language == "" {
+		language = "en"
+	}
+	modified := opts.modified
+	if modified.IsZero() {
+		modified = time.Now()
+	}
+	id := newRecordID()
+
+	var manifest, spine strings.Builder
+	var toc []*tocEntry
+	chapters := map[string]string{}
+	for i, data := range records {
+		href := fmt.Sprintf("article%d.xhtml", i+1)
+		chapter, entry := epubChapter(data, href, language)
+		chapters[href] = chapter
+		toc = append(toc, entry)
+		fmt.Fprintf(&manifest, "    <item id=\"article%d\" href=\"%s\" media-type=\"application/xhtml+xml\"/>\n", i+1, href)
+		fmt.Fprintf(&spine, "    <itemref idref=\"article%d\"/>\n", i+1)
+	}
+
+	opf := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="bookid" xml:lang="%[1]s">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:identifier id="bookid">%[2]s</dc:identifier>
+    <dc:title>%[3]s</dc:title>
+    <dc:language>%[1]s</dc:language>
+    <meta property="dcterms:modified">%[4]s</meta>
+  </metadata>
+  <manifest>
+    <item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>
+    <item id="ncx" href="toc.ncx" media-type="application/x-dtbncx+xml"/>
+%[5]s  </manifest>
+  <spine toc="ncx">
+%[6]s  </spine>
+</package>
+`, xmlText(language), id, xmlText(opts.title), modified.UTC().Format("2006-01-02T15:04:05Z"), manifest.String(), spine.String())
+
+	var nav strings.Builder
+	fmt.Fprintf(&nav, `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops" xml:lang="%[1]s" lang="%[1]s">
+<head>
+<meta charset="UTF-8"/>
+<title>%[2]s</title>
+</head>
+<body>
+<nav epub:type="toc" id="toc">
+<h1>Contents</h1>
+`, xmlText(language), xmlText(opts.title))
+	writeNav(&nav, toc, "")
+	nav.WriteString("</nav>\n</body>\n</html>\n")
+
+	var ncx strings.Builder
+	fmt.Fprintf(&ncx, `<?xml version="1.0" encoding="UTF-8"?>
+<ncx xmlns="http://www.daisy.org/z3986/2005/ncx/" version="2005-1">
+  <head>
+    <meta name="dtb:uid" content="%s"/>
+  </head>
+  <docTitle><text>%s</text></docTitle>
+  <navMap>
+`, id, xmlText(opts.title))
+	points := 0
+	writeNavPoints(&ncx, toc, "    ", &points)
+	ncx.WriteString("  </navMap>\n</ncx>\n")
+
+	zw := zip.NewWriter(w)
+	// The mimetype file comes first and uncompressed, so that the type of
+	// the file can be read at a fixed offset.
+	mimetype, err := zw.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store, Modified: modified})
+	if err != nil {
+		return err
+	}
+	io.WriteString(mimetype, "application/epub+zip")
+
+	files := []struct{ name, content string }{
+		{"META-INF/container.xml", `<?xml version="1.0" encoding="UTF-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>
+`},
+		{"OEBPS/content.opf", opf},
+		{"OEBPS/nav.xhtml", nav.String()},
+		{"OEBPS/toc.ncx", ncx.String()},
+	}
+	for i := range records {
+		href := fmt.Sprintf("article%d.xhtml", i+1)
+		files = append(files, struct{ name, content string }{"OEBPS/" + href, chapters[href]})
+	}
+	for _, f := range files {
+		fw, err := zw.CreateHeader(&zip.FileHeader{Name: f.name, Method: zip.Deflate, Modified: modified})
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(fw, f.content); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// writeEPUBFile writes the book to fileName.
+func writeEPUBFile(fileName string, records []WebsiteData, opts epubOptions) error {
+	file, err := os.Create(fileName)
+	if err != nil {
+		return fmt.Errorf("failed to create file %s: %w", fileName, err)
+	}
+	if err := writeEPUB(file, records, opts); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write %s: %w", fileName, err)
+	}
+	return file.Close()
+}
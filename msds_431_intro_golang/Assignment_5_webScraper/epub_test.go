@@ -0,0 +1,108 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteEPUB(t *testing.T) {
+	blog := parseBlog(t)
+	chatbot := parseFixture(t, "chatbot", fixtures["chatbot"])
+	modified := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	var buf bytes.Buffer
+	if err := writeEPUB(&buf, []WebsiteData{blog, chatbot}, epubOptions{title: "Robots & arms", modified: modified}); err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Readers find the mimetype at a fixed offset: first and uncompressed.
+	if first := zr.File[0]; first.Name != "mimetype" || first.Method != zip.Store {
+		t.Errorf("first entry is %s with method %d", first.Name, first.Method)
+	}
+	files := map[string]string{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[f.Name] = string(content)
+	}
+	if files["mimetype"] != "application/epub+zip" {
+		t.Errorf("mimetype = %q", files["mimetype"])
+	}
+
+	// Every file but the mimetype must be well-formed XML.
+	for name, content := range files {
+		if name == "mimetype" {
+			continue
+		}
+		d := xml.NewDecoder(strings.NewReader(content))
+		d.Strict = true
+		for {
+			if _, err := d.Token(); err == io.EOF {
+				break
+			} else if err != nil {
+				t.Errorf("%s is not well-formed: %v", name, err)
+				break
+			}
+		}
+	}
+
+	opf := files["OEBPS/content.opf"]
+	for _, want := range []string{
+		"<dc:title>Robots &amp; arms</dc:title>",
+		"<dc:language>en</dc:language>",
+		`<meta property="dcterms:modified">2024-03-01T12:00:00Z</meta>`,
+		`<item id="article2" href="article2.xhtml" media-type="application/xhtml+xml"/>`,
+		`<itemref idref="article2"/>`,
+	} {
+		if !strings.Contains(opf, want) {
+			t.Errorf("content.opf lacks %s", want)
+		}
+	}
+	if !strings.Contains(files["META-INF/container.xml"], `full-path="OEBPS/content.opf"`) {
+		t.Error("container.xml does not point to content.opf")
+	}
+
+	// The table of contents nests Calibration under Servo arms.
+	nav := files["OEBPS/nav.xhtml"]
+	servo := strings.Index(nav, `<a href="article1.xhtml#section1">Servo arms</a>`)
+	calibration := strings.Index(nav, `<a href="article1.xhtml#section2">Calibration</a>`)
+	stepper := strings.Index(nav, `<a href="article1.xhtml#section3">Stepper arms</a>`)
+	if servo < 0 || calibration < servo || stepper < calibration ||
+		strings.Count(nav[servo:calibration], "<ol>") != 1 || strings.Count(nav[calibration:stepper], "</ol>") != 1 {
+		t.Errorf("nav.xhtml does not nest the sections:\n%s", nav)
+	}
+	if !strings.Contains(nav, `<a href="article2.xhtml">Chatbot</a>`) {
+		t.Error("nav.xhtml does not list the second article")
+	}
+	if got := strings.Count(files["OEBPS/toc.ncx"], "<navPoint "); got != strings.Count(nav, "<li>") {
+		t.Errorf("toc.ncx has %d entries, nav.xhtml %d", got, strings.Count(nav, "<li>"))
+	}
+
+	chapter := files["OEBPS/article1.xhtml"]
+	for _, want := range []string{
+		"<h1>Choosing a robot arm</h1>",
+		`<h3 id="section2">Calibration</h3>`,
+		"<li>Low cost</li>",
+		"<blockquote><p>Precision is worth the extra weight.</p></blockquote>",
+		`<a href="` + blogURL + `">`,
+	} {
+		if !strings.Contains(chapter, want) {
+			t.Errorf("article1.xhtml lacks %s", want)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+// runExport implements the "export" command, which converts a scrape
+// into other formats.
+func runExport(args []string) int {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	input := fs.String("input", "wikipedia_data.jsonl", "scraped JSON lines file to export")
+	format := fs.String("format", "chunks", "output format: chunks, markdown (one file per article) or epub (one book)")
+	output := fs.String("output", "", "file to write, or directory for markdown; defaults to chunks.jsonl, markdown or wikipedia_data.epub")
+	title := fs.String("title", "Scraped Wikipedia articles", "book title for -format epub")
+	size := fs.Int("chunk-size", 1000, "maximum chunk size, in -chunk-unit")
+	overlap := fs.Int("chunk-overlap", 100, "overlap between consecutive chunks of a section, in -chunk-unit")
+	unit := fs.String("chunk-unit", "chars", "unit for chunk size and overlap: chars or tokens (approximate)")
+	fs.Parse(args)
+
+	if *output == "" {
+		*output = map[string]string{"chunks": "chunks.jsonl", "markdown": "markdown", "epub": "wikipedia_data.epub"}[*format]
+	}
+
+	records, err := readRecords(*input)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+
+	switch *format {
+	case "chunks":
+		opts := chunkOptions{size: *size, overlap: *overlap, unit: *unit}
+		if err := opts.validate(); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 2
+		}
+		file, err := os.Create(*output)
+		if err != nil {
+			fmt.Printf("Error creating file: %v\n", err)
+			return 1
+		}
+		defer file.Close()
+		count, err := writeChunks(file, records, opts)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		}
+		fmt.Printf("Wrote %d chunks from %d articles to %s\n", count, len(records), *output)
+	case "markdown":
+		count, err := writeMarkdownFiles(*output, records)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		}
+		fmt.Printf("Wrote %d articles as Markdown to %s\n", count, *output)
+	case "epub":
+		if err := writeEPUBFile(*output, records, epubOptions{title: *title}); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		}
+		fmt.Printf("Wrote %d articles to %s\n", len(records), *output)
+	default:
+		fmt.Printf("Error: unknown format %q\n", *format)
+		return 2
+	}
+	return 0
+}
@@ -0,0 +1,379 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// graphBaseName is the default name, without extension, of the files
+// written by the graph command.
+const graphBaseName = "wikipedia_graph"
+
+// GraphScores place an article in the link graph of a scrape. Only links
+// between scraped articles count.
+type GraphScores struct {
+	PageRank  float64 `json:"pagerank"`
+	InDegree  int     `json:"in_degree"`
+	OutDegree int     `json:"out_degree"`
+}
+
+type graphNode struct {
+	URL    string
+	Title  string
+	Scores GraphScores
+}
+
+// graphEdge is a link from one node to another. Count is the number of
+// links to the target in the source article.
+type graphEdge struct {
+	From, To int
+	Count    int
+}
+
+// linkGraph is the directed graph of internal links between the articles
+// of a scrape. Nodes are in record order and edges are sorted by source
+// and target.
+type linkGraph struct {
+	nodes []graphNode
+	index map[string]int // articleKey -> node
+	edges []graphEdge
+}
+
+// articleKey identifies the article a URL points to, so that links match
+// the records they name however their titles are escaped. It returns ""
+// for URLs that are not /wiki/ pages.
+func articleKey(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || !strings.HasPrefix(u.Path, "/wiki/") {
+		return ""
+	}
+	title := strings.ReplaceAll(strings.TrimPrefix(u.Path, "/wiki/"), " ", "_")
+	if title == "" {
+		return ""
+	}
+	return strings.ToLower(u.Host) + "/" + title
+}
+
+// articleLinks returns the pages an article links to, with the number of
+// links to each. Records written before out_links existed only have the
+// links of their paragraphs, each counted once per link; links to
+// namespace pages among them are left out, as outLinks does.
+func articleLinks(data WebsiteData) []OutLink {
+	if data.OutLinks != nil {
+		return data.OutLinks
+	}
+	var links []OutLink
+	var walk func(secs []*Section)
+	walk = func(secs []*Section) {
+		for _, sec := range secs {
+			for _, p := range sec.Paragraphs {
+				for _, l := range p.Links {
+					if l.Type != "internal" {
+						continue
+					}
+					if u, err := url.Parse(l.URL); err == nil && isArticlePath(u.Path) {
+						links = append(links, OutLink{URL: l.URL, Count: 1})
+					}
+				}
+			}
+			walk(sec.Children)
+		}
+	}
+	walk(data.SectionTree)
+	return links
+}
+
+// buildLinkGraph makes a node for every article of records, merging
+// records of the same URL, and an edge for every article that links to
+// another. Links to articles that were not scraped and links of an
+// article to itself are left out.
+func buildLinkGraph(records []WebsiteData) *linkGraph {
+	g := &linkGraph{index: map[string]int{}}
+	for _, data := range records {
+		key := articleKey(data.URL)
+		if key == "" {
+			continue
+		}
+		if _, ok := g.index[key]; !ok {
+			g.index[key] = len(g.nodes)
+			g.nodes = append(g.nodes, graphNode{URL: data.URL, Title: data.Title})
+		}
+	}
+
+	counts := map[[2]int]int{}
+	linked := map[int]bool{}
+	for _, data := range records {
+		from, ok := g.index[articleKey(data.URL)]
+		if !ok || linked[from] {
+			continue
+		}
+		linked[from] = true
+		for _, link := range articleLinks(data) {
+			to, ok := g.index[articleKey(link.URL)]
+			if ok && to != from {
+				counts[[2]int{from, to}] += link.Count
+			}
+		}
+	}
+	for pair, n := range counts {
+		g.edges = append(g.edges, graphEdge{From: pair[0], To: pair[1], Count: n})
+	}
+	sort.Slice(g.edges, func(i, j int) bool {
+		if g.edges[i].From != g.edges[j].From {
+			return g.edges[i].From < g.edges[j].From
+		}
+		return g.edges[i].To < g.edges[j].To
+	})
+
+	for _, e := range g.edges {
+		g.nodes[e.From].Scores.OutDegree++
+		g.nodes[e.To].Scores.InDegree++
+	}
+	return g
+}
+
+// rank computes the PageRank of every node with the given damping
+// factor. Every link between two articles counts once, however often it
+// appears. The rank of articles without links is spread over all
+// articles, so the ranks add up to 1.
+func (g *linkGraph) rank(damping float64) {
+	n := len(g.nodes)
+	if n == 0 {
+		return
+	}
+	ranks := make([]float64, n)
+	for i := range ranks {
+		ranks[i] = 1 / float64(n)
+	}
+	next := make([]float64, n)
+	for iter := 0; iter < 100; iter++ {
+		dangling := 0.0
+		for i, node := range g.nodes {
+			if node.Scores.OutDegree == 0 {
+				dangling += ranks[i]
+			}
+		}
+		for i := range next {
+			next[i] = (1-damping)/float64(n) + damping*dangling/float64(n)
+		}
+		for _, e := range g.edges {
+			next[e.To] += damping * ranks[e.From] / float64(g.nodes[e.From].Scores.OutDegree)
+		}
+		delta := 0.0
+		for i := range ranks {
+			delta += math.Abs(next[i] - ranks[i])
+		}
+		ranks, next = next, ranks
+		if delta < 1e-10 {
+			break
+		}
+	}
+	for i := range g.nodes {
+		g.nodes[i].Scores.PageRank = ranks[i]
+	}
+}
+
+// scores returns the scores of the node for a record URL, or nil when the
+// URL is not in the graph.
+func (g *linkGraph) scores(pageURL string) *GraphScores {
+	i, ok := g.index[articleKey(pageURL)]
+	if !ok {
+		return nil
+	}
+	scores := g.nodes[i].Scores
+	return &scores
+}
+
+// writeGraphML writes the graph in the GraphML format, with the title,
+// URL and scores of every node and the link count of every edge.
+func (g *linkGraph) writeGraphML(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString(xml.Header)
+	bw.WriteString(`<graphml xmlns="http://graphml.graphdrawing.org/xmlns">` + "\n")
+	for _, key := range []struct{ id, domain, kind string }{
+		{"title", "node", "string"},
+		{"url", "node", "string"},
+		{"pagerank", "node", "double"},
+		{"in_degree", "node", "int"},
+		{"out_degree", "node", "int"},
+		{"weight", "edge", "int"},
+	} {
+		fmt.Fprintf(bw, "  <key id=%q for=%q attr.name=%q attr.type=%q/>\n", key.id, key.domain, key.id, key.kind)
+	}
+	bw.WriteString(`  <graph id="wikipedia" edgedefault="directed">` + "\n")
+	for i, node := range g.nodes {
+		fmt.Fprintf(bw, "    <node id=\"n%d\">\n", i)
+		fmt.Fprintf(bw, "      <data key=\"title\">%s</data>\n", xmlText(node.Title))
+		fmt.Fprintf(bw, "      <data key=\"url\">%s</data>\n", xmlText(node.URL))
+		fmt.Fprintf(bw, "      <data key=\"pagerank\">%s</data>\n", formatRank(node.Scores.PageRank))
+		fmt.Fprintf(bw, "      <data key=\"in_degree\">%d</data>\n", node.Scores.InDegree)
+		fmt.Fprintf(bw, "      <data key=\"out_degree\">%d</data>\n", node.Scores.OutDegree)
+		bw.WriteString("    </node>\n")
+	}
+	for _, e := range g.edges {
+		fmt.Fprintf(bw, "    <edge source=\"n%d\" target=\"n%d\">\n", e.From, e.To)
+		fmt.Fprintf(bw, "      <data key=\"weight\">%d</data>\n", e.Count)
+		bw.WriteString("    </edge>\n")
+	}
+	bw.WriteString("  </graph>\n</graphml>\n")
+	return bw.Flush()
+}
+
+func xmlText(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// writeDOT writes the graph in the Graphviz DOT language.
+func (g *linkGraph) writeDOT(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString("digraph wikipedia {\n")
+	for i, node := range g.nodes {
+		fmt.Fprintf(bw, "  n%d [label=%s, URL=%s, pagerank=%s];\n", i, dotQuote(node.Title), dotQuote(node.URL), formatRank(node.Scores.PageRank))
+	}
+	for _, e := range g.edges {
+		fmt.Fprintf(bw, "  n%d -> n%d [weight=%d];\n", e.From, e.To, e.Count)
+	}
+	bw.WriteString("}\n")
+	return bw.Flush()
+}
+
+func dotQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
+
+// writeEdgeCSV writes one row per edge with the URLs of both articles and
+// the number of links.
+func (g *linkGraph) writeEdgeCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"source", "target", "weight"})
+	for _, e := range g.edges {
+		cw.Write([]string{g.nodes[e.From].URL, g.nodes[e.To].URL, strconv.Itoa(e.Count)})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func formatRank(r float64) string {
+	return strconv.FormatFloat(r, 'f', 6, 64)
+}
+
+// graphFormats maps the -format names of the graph command to the suffix
+// of their file and the function that writes them.
+var graphFormats = []struct {
+	name, suffix string
+	write        func(*linkGraph, io.Writer) error
+}{
+	{"graphml", ".graphml", (*linkGraph).writeGraphML},
+	{"dot", ".dot", (*linkGraph).writeDOT},
+	{"csv", "_edges.csv", (*linkGraph).writeEdgeCSV},
+}
+
+// runGraph implements the "graph" command, which builds the link graph
+// of a scrape and exports it. With -update it also writes the scores of
+// every article into its record.
+func runGraph(args []string) int {
+	fs := flag.NewFlagSet("graph", flag.ExitOnError)
+	input := fs.String("input", "wikipedia_data.jsonl", "scraped JSON lines file")
+	output := fs.String("output", graphBaseName, "name of the graph files without extension; .graphml, .dot and _edges.csv are added")
+	formats := fs.String("format", "graphml,dot,csv", "comma separated formats to write: graphml, dot, csv")
+	damping := fs.Float64("damping", 0.85, "PageRank damping factor, between 0 and 1")
+	update := fs.Bool("update", false, "also write the scores into the records of -input, rewriting it")
+	top := fs.Int("top", 10, "number of top ranked articles to print")
+	fs.Parse(args)
+
+	if *damping <= 0 || *damping >= 1 {
+		fmt.Println("Error: -damping must be between 0 and 1")
+		return 2
+	}
+	wanted := map[string]bool{}
+	for _, name := range splitList(*formats) {
+		wanted[name] = true
+	}
+	for _, f := range graphFormats {
+		delete(wanted, f.name)
+	}
+	for name := range wanted {
+		fmt.Printf("Error: unknown format %q, want graphml, dot or csv\n", name)
+		return 2
+	}
+
+	records, err := readRecords(*input)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	g := buildLinkGraph(records)
+	g.rank(*damping)
+	fmt.Printf("Link graph: %d articles, %d links\n", len(g.nodes), len(g.edges))
+
+	for _, name := range splitList(*formats) {
+		for _, f := range graphFormats {
+			if f.name != name {
+				continue
+			}
+			fileName := *output + f.suffix
+			if err := writeGraphFile(fileName, g, f.write); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				return 1
+			}
+			fmt.Printf("Wrote %s\n", fileName)
+		}
+	}
+
+	if *update {
+		if err := writeRecordScores(*input, records, g); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		}
+		fmt.Printf("Updated the scores of %d records in %s\n", len(records), *input)
+	}
+
+	order := make([]int, len(g.nodes))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return g.nodes[order[a]].Scores.PageRank > g.nodes[order[b]].Scores.PageRank
+	})
+	if len(order) > *top {
+		order = order[:*top]
+	}
+	for _, i := range order {
+		node := g.nodes[i]
+		fmt.Printf("%s  %s (in %d, out %d)\n", formatRank(node.Scores.PageRank), node.Title, node.Scores.InDegree, node.Scores.OutDegree)
+	}
+	return 0
+}
+
+func writeGraphFile(fileName string, g *linkGraph, write func(*linkGraph, io.Writer) error) error {
+	var b strings.Builder
+	if err := write(g, &b); err != nil {
+		return fmt.Errorf("failed to write %s: %w", fileName, err)
+	}
+	if err := writeFileAtomic(fileName, []byte(b.String())); err != nil {
+		return fmt.Errorf("failed to write %s: %w", fileName, err)
+	}
+	return nil
+}
+
+// writeRecordScores rewrites the JSON lines file with the graph scores
+// set on every record.
+func writeRecordScores(fileName string, records []WebsiteData, g *linkGraph) error {
+	scored := make([]WebsiteData, len(records))
+	for i, data := range records {
+		data.Graph = g.scores(data.URL)
+		scored[i] = data
+	}
+	return writeJSONLFile(fileName, scored)
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// linking returns a record whose lead links to every URL in links.
+func linking(pageURL, title string, links ...string) WebsiteData {
+	para := Paragraph{Text: title}
+	for _, l := range links {
+		para.Links = append(para.Links, Link{Text: l, URL: l, Type: "internal"})
+	}
+	lead := &Section{Title: "main_summary", Level: 1, Paragraphs: []Paragraph{para}}
+	return WebsiteData{SchemaVersion: SchemaVersion, URL: pageURL, Title: title, SectionTree: []*Section{lead}}
+}
+
+func TestArticleKey(t *testing.T) {
+	tests := []struct {
+		url, want string
+	}{
+		{"https://en.wikipedia.org/wiki/Android_(robot)", "en.wikipedia.org/Android_(robot)"},
+		{"https://en.wikipedia.org/wiki/Android_%28robot%29#History", "en.wikipedia.org/Android_(robot)"},
+		{"https://EN.wikipedia.org/wiki/Lead%E2%80%93acid_battery", "en.wikipedia.org/Lead–acid_battery"},
+		{"https://en.wikipedia.org/wiki/Robot Operating System", "en.wikipedia.org/Robot_Operating_System"},
+		{"https://en.wikipedia.org/w/index.php?title=Robot", ""},
+		{"https://en.wikipedia.org/wiki/", ""},
+	}
+	for _, tt := range tests {
+		if got := articleKey(tt.url); got != tt.want {
+			t.Errorf("articleKey(%q) = %q, want %q", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestBuildLinkGraph(t *testing.T) {
+	const wiki = "https://en.wikipedia.org/wiki/"
+	records := []WebsiteData{
+		linking(wiki+"Robot", "Robot", wiki+"Robotics", wiki+"Robotics#History", wiki+"Robot", wiki+"Not_scraped"),
+		linking(wiki+"Chatbot", "Chatbot", wiki+"Robotics"),
+		linking(wiki+"Robotics", "Robotics", wiki+"Robot"),
+		linking(wiki+"Lonely", "Lonely"),
+		linking(wiki+"Robot", "Robot (again)"),
+	}
+	g := buildLinkGraph(records)
+
+	if len(g.nodes) != 4 {
+		t.Fatalf("got %d nodes, want 4", len(g.nodes))
+	}
+	want := []graphEdge{{From: 0, To: 2, Count: 2}, {From: 1, To: 2, Count: 1}, {From: 2, To: 0, Count: 1}}
+	if !reflect.DeepEqual(g.edges, want) {
+		t.Errorf("edges = %+v, want %+v", g.edges, want)
+	}
+
+	g.rank(0.85)
+	sum := 0.0
+	for _, node := range g.nodes {
+		sum += node.Scores.PageRank
+	}
+	if math.Abs(sum-1) > 1e-9 {
+		t.Errorf("ranks add up to %g, want 1", sum)
+	}
+	robot, chatbot, robotics, lonely := g.nodes[0].Scores, g.nodes[1].Scores, g.nodes[2].Scores, g.nodes[3].Scores
+	if !(robotics.PageRank > robot.PageRank && robot.PageRank > chatbot.PageRank) {
+		t.Errorf("ranks robotics %g, robot %g, chatbot %g are out of order", robotics.PageRank, robot.PageRank, chatbot.PageRank)
+	}
+	if chatbot.PageRank != lonely.PageRank {
+		t.Errorf("articles without in-links rank %g and %g, want the same", chatbot.PageRank, lonely.PageRank)
+	}
+	if robotics.InDegree != 2 || robotics.OutDegree != 1 || lonely.InDegree != 0 || lonely.OutDegree != 0 {
+		t.Errorf("degrees: robotics %+v, lonely %+v", robotics, lonely)
+	}
+	if s := g.scores(wiki + "Robotics"); s == nil || *s != robotics {
+		t.Errorf("scores(Robotics) = %v, want %+v", s, robotics)
+	}
+	if s := g.scores(wiki + "Not_scraped"); s != nil {
+		t.Errorf("scores(Not_scraped) = %+v, want nil", s)
+	}
+}
+
+// TestLinkGraphFixture checks that the links of a parsed article become
+// edges: the robotics fixture links to Cybernetics in a paragraph, to
+// Android only in its navigation box and to Robot in both.
+func TestLinkGraphFixture(t *testing.T) {
+	robotics := parseFixture(t, "robotics", fixtures["robotics"])
+	cybernetics := linking("https://en.wikipedia.org/wiki/Cybernetics", "Cybernetics")
+	android := linking("https://en.wikipedia.org/wiki/Android_(robot)", "Android")
+	robot := linking("https://en.wikipedia.org/wiki/Robot", "Robot")
+	g := buildLinkGraph([]WebsiteData{robotics, cybernetics, android, robot})
+	want := []graphEdge{{From: 0, To: 1, Count: 1}, {From: 0, To: 2, Count: 1}, {From: 0, To: 3, Count: 2}}
+	if !reflect.DeepEqual(g.edges, want) {
+		t.Errorf("edges = %+v, want %+v", g.edges, want)
+	}
+
+	// Records without out_links fall back to the links of their paragraphs.
+	robotics.OutLinks = nil
+	g = buildLinkGraph([]WebsiteData{robotics, cybernetics, android, robot})
+	want = []graphEdge{{From: 0, To: 1, Count: 1}, {From: 0, To: 3, Count: 1}}
+	if !reflect.DeepEqual(g.edges, want) {
+		t.Errorf("edges from paragraph links = %+v, want %+v", g.edges, want)
+	}
+}
+
+func TestGraphExports(t *testing.T) {
+	const wiki = "https://en.wikipedia.org/wiki/"
+	g := buildLinkGraph([]WebsiteData{
+		linking(wiki+"AT%26T", `AT&T "Bell"`, wiki+"Robot"),
+		linking(wiki+"Robot", "Robot", wiki+"AT%26T"),
+	})
+	g.rank(0.85)
+
+	var graphml bytes.Buffer
+	if err := g.writeGraphML(&graphml); err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		Graph struct {
+			Nodes []struct {
+				ID   string `xml:"id,attr"`
+				Data []struct {
+					Key   string `xml:"key,attr"`
+					Value string `xml:",chardata"`
+				} `xml:"data"`
+			} `xml:"node"`
+			Edges []struct {
+				Source string `xml:"source,attr"`
+				Target string `xml:"target,attr"`
+			} `xml:"edge"`
+		} `xml:"graph"`
+	}
+	if err := xml.Unmarshal(graphml.Bytes(), &doc); err != nil {
+		t.Fatalf("invalid GraphML: %v\n%s", err, graphml.String())
+	}
+	if len(doc.Graph.Nodes) != 2 || len(doc.Graph.Edges) != 2 {
+		t.Fatalf("GraphML has %d nodes and %d edges, want 2 and 2", len(doc.Graph.Nodes), len(doc.Graph.Edges))
+	}
+	if title := doc.Graph.Nodes[0].Data[0]; title.Key != "title" || title.Value != `AT&T "Bell"` {
+		t.Errorf("first node data = %+v, want the title", title)
+	}
+
+	var dot bytes.Buffer
+	if err := g.writeDOT(&dot); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		`  n0 [label="AT&T \"Bell\"", URL="https://en.wikipedia.org/wiki/AT%26T", pagerank=0.500000];`,
+		`  n0 -> n1 [weight=1];`,
+		`  n1 -> n0 [weight=1];`,
+	} {
+		if !strings.Contains(dot.String(), line+"\n") {
+			t.Errorf("DOT output lacks %q:\n%s", line, dot.String())
+		}
+	}
+
+	var edges bytes.Buffer
+	if err := g.writeEdgeCSV(&edges); err != nil {
+		t.Fatal(err)
+	}
+	want := "source,target,weight\n" +
+		"https://en.wikipedia.org/wiki/AT%26T,https://en.wikipedia.org/wiki/Robot,1\n" +
+		"https://en.wikipedia.org/wiki/Robot,https://en.wikipedia.org/wiki/AT%26T,1\n"
+	if edges.String() != want {
+		t.Errorf("edge list =\n%s\nwant\n%s", edges.String(), want)
+	}
+}
+
+func TestRunGraph(t *testing.T) {
+	const wiki = "https://en.wikipedia.org/wiki/"
+	dir := t.TempDir()
+	input := filepath.Join(dir, "data.jsonl")
+	var lines []string
+	for _, data := range []WebsiteData{
+		linking(wiki+"Robot", "Robot", wiki+"Robotics"),
+		linking(wiki+"Robotics", "Robotics"),
+	} {
+		lines = append(lines, mustJSON(t, data))
+	}
+	if err := os.WriteFile(input, []byte(strings.Join(lines, "\n")+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	output := filepath.Join(dir, "graph")
+	before, err := os.ReadFile(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code := runGraph([]string{"-input", input, "-output", output, "-format", "graphml,csv"}); code != 0 {
+		t.Fatalf("runGraph returned %d", code)
+	}
+	for _, suffix := range []string{".graphml", "_edges.csv"} {
+		if _, err := os.Stat(output + suffix); err != nil {
+			t.Errorf("missing %s: %v", suffix, err)
+		}
+	}
+	if _, err := os.Stat(output + ".dot"); err == nil {
+		t.Errorf("wrote .dot although it was not requested")
+	}
+
+	// The input is only rewritten with -update.
+	if after, _ := os.ReadFile(input); !bytes.Equal(after, before) {
+		t.Errorf("runGraph without -update changed %s", input)
+	}
+	if code := runGraph([]string{"-input", input, "-output", output, "-format", "csv", "-update"}); code != 0 {
+		t.Fatalf("runGraph -update returned %d", code)
+	}
+	records, err := readRecords(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[0].Graph == nil || records[1].Graph == nil {
+		t.Fatalf("records were not updated with scores: %+v", records)
+	}
+	if g := records[1].Graph; g.InDegree != 1 || g.OutDegree != 0 || g.PageRank <= records[0].Graph.PageRank {
+		t.Errorf("Robotics scores = %+v, Robot scores = %+v", *g, *records[0].Graph)
+	}
+
+	if code := runGraph([]string{"-input", input, "-format", "svg"}); code != 2 {
+		t.Errorf("runGraph with an unknown format returned %d, want 2", code)
+	}
+}
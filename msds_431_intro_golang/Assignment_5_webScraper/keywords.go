@@ -0,0 +1,303 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// termScore is a word or bigram with its TF-IDF score.
+type termScore struct {
+	Term  string  `json:"term"`
+	Score float64 `json:"score"`
+}
+
+// sectionKeywords are the most distinctive terms of one section.
+type sectionKeywords struct {
+	SectionPath []string    `json:"section_path"`
+	Terms       []termScore `json:"terms"`
+	Bigrams     []termScore `json:"bigrams"`
+}
+
+// articleKeywords are the most distinctive terms of an article and of
+// each of its sections; one line of the JSON output.
+type articleKeywords struct {
+	URL      string            `json:"url"`
+	Title    string            `json:"title"`
+	Terms    []termScore       `json:"terms"`
+	Bigrams  []termScore       `json:"bigrams"`
+	Sections []sectionKeywords `json:"sections,omitempty"`
+}
+
+// termCounts holds how often each word and each bigram occurs in a
+// document, and how many of each there are in total.
+type termCounts struct {
+	words, bigrams           map[string]int
+	totalWords, totalBigrams int
+}
+
+// countTerms counts the words of paragraphs that are not stop words, and
+// the bigrams of adjacent such words. A stop word, a number or the end of
+// a sentence breaks a bigram.
+func countTerms(paragraphs []string, stop stopWords) termCounts {
+	c := termCounts{words: map[string]int{}, bigrams: map[string]int{}}
+	for _, p := range paragraphs {
+		for _, sentence := range splitSentences(p) {
+			prev := ""
+			for _, tok := range tokenize(sentence) {
+				if stop[tok] || len([]rune(tok)) < 2 || strings.IndexFunc(tok, unicode.IsLetter) < 0 {
+					prev = ""
+					continue
+				}
+				c.words[tok]++
+				c.totalWords++
+				if prev != "" {
+					c.bigrams[prev+" "+tok]++
+					c.totalBigrams++
+				}
+				prev = tok
+			}
+		}
+	}
+	return c
+}
+
+// documentFrequency counts the documents each term occurs in.
+type documentFrequency struct {
+	docs int
+	df   map[string]int
+}
+
+func (d *documentFrequency) add(counts map[string]int) {
+	if d.df == nil {
+		d.df = map[string]int{}
+	}
+	d.docs++
+	for term := range counts {
+		d.df[term]++
+	}
+}
+
+// idf is the smoothed inverse document frequency of a term. A term found
+// in every document gets 1, rarer terms more.
+func (d *documentFrequency) idf(term string) float64 {
+	return math.Log(float64(1+d.docs)/float64(1+d.df[term])) + 1
+}
+
+// top returns the k terms with the highest TF-IDF score, where the term
+// frequency is the share of the document's terms. Ties are broken by the
+// term, so the output is stable.
+func (d *documentFrequency) top(counts map[string]int, total, k int) []termScore {
+	scores := []termScore{}
+	for term, n := range counts {
+		score := float64(n) / float64(total) * d.idf(term)
+		scores = append(scores, termScore{Term: term, Score: math.Round(score*1e6) / 1e6})
+	}
+	sort.Slice(scores, func(i, j int) bool {
+		if scores[i].Score != scores[j].Score {
+			return scores[i].Score > scores[j].Score
+		}
+		return scores[i].Term < scores[j].Term
+	})
+	if len(scores) > k {
+		scores = scores[:k]
+	}
+	return scores
+}
+
+// extractKeywords scores the words and bigrams of every article against
+// all articles, and those of every section against all sections. With
+// withSections false only articles are scored. Sections without terms
+// are left out.
+func extractKeywords(records []WebsiteData, stop stopWords, k int, withSections bool) []articleKeywords {
+	type section struct {
+		path   []string
+		counts termCounts
+	}
+	articles := make([]termCounts, len(records))
+	sections := make([][]section, len(records))
+	var articleWords, articleBigrams, sectionWords, sectionBigrams documentFrequency
+	for i, data := range records {
+		var all []string
+		for _, sec := range sectionTexts(data) {
+			all = append(all, sec.Paragraphs...)
+			if withSections {
+				counts := countTerms(sec.Paragraphs, stop)
+				sectionWords.add(counts.words)
+				sectionBigrams.add(counts.bigrams)
+				sections[i] = append(sections[i], section{sec.Path, counts})
+			}
+		}
+		articles[i] = countTerms(all, stop)
+		articleWords.add(articles[i].words)
+		articleBigrams.add(articles[i].bigrams)
+	}
+
+	out := make([]articleKeywords, len(records))
+	for i, data := range records {
+		out[i] = articleKeywords{
+			URL:     data.URL,
+			Title:   data.Title,
+			Terms:   articleWords.top(articles[i].words, articles[i].totalWords, k),
+			Bigrams: articleBigrams.top(articles[i].bigrams, articles[i].totalBigrams, k),
+		}
+		for _, sec := range sections[i] {
+			if sec.counts.totalWords == 0 {
+				continue
+			}
+			out[i].Sections = append(out[i].Sections, sectionKeywords{
+				SectionPath: sec.path,
+				Terms:       sectionWords.top(sec.counts.words, sec.counts.totalWords, k),
+				Bigrams:     sectionBigrams.top(sec.counts.bigrams, sec.counts.totalBigrams, k),
+			})
+		}
+	}
+	return out
+}
+
+// loadStopWords builds the stop word list from a comma separated list of
+// sources: "english" for the built-in English list, "none" for no stop
+// words, or the name of a file of whitespace separated words.
+func loadStopWords(sources string) (stopWords, error) {
+	stop := stopWords{}
+	// Not splitList, which would lower case the file names.
+	for _, source := range strings.Split(sources, ",") {
+		source = strings.TrimSpace(source)
+		var list stopWords
+		switch source {
+		case "english":
+			list = englishStopWords
+		case "none", "":
+			continue
+		default:
+			raw, err := os.ReadFile(source)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read stop words: %w", err)
+			}
+			list = newStopWords(strings.ToLower(string(raw)))
+		}
+		for w := range list {
+			stop[w] = true
+		}
+	}
+	return stop, nil
+}
+
+// writeKeywordCSV writes one row per term: the article, the section path
+// joined by " > " (empty for the whole article), whether it is a word or a
+// bigram, its rank and its score.
+func writeKeywordCSV(w io.Writer, keywords []articleKeywords) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"url", "title", "section", "kind", "rank", "term", "score"})
+	rows := func(a articleKeywords, section string, kind string, terms []termScore) {
+		for i, t := range terms {
+			cw.Write([]string{a.URL, a.Title, section, kind, strconv.Itoa(i + 1), t.Term, strconv.FormatFloat(t.Score, 'f', -1, 64)})
+		}
+	}
+	for _, a := range keywords {
+		rows(a, "", "term", a.Terms)
+		rows(a, "", "bigram", a.Bigrams)
+		for _, sec := range a.Sections {
+			path := strings.Join(sec.SectionPath, " > ")
+			rows(a, path, "term", sec.Terms)
+			rows(a, path, "bigram", sec.Bigrams)
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeKeywordJSON writes one JSON line per article.
+func writeKeywordJSON(w io.Writer, keywords []articleKeywords) error {
+	return writeJSONL(w, keywords)
+}
+
+// keywordFormats maps the -format names of the keywords command to the
+// suffix of their file and the function that writes them.
+var keywordFormats = []struct {
+	name, suffix string
+	write        func(io.Writer, []articleKeywords) error
+}{
+	{"csv", ".csv", writeKeywordCSV},
+	{"json", ".jsonl", writeKeywordJSON},
+}
+
+// runKeywords implements the "keywords" command, which extracts the most
+// distinctive words and bigrams of every article and section by TF-IDF.
+func runKeywords(args []string) int {
+	fs := flag.NewFlagSet("keywords", flag.ExitOnError)
+	input := fs.String("input", "wikipedia_data.jsonl", "scraped JSON lines file")
+	output := fs.String("output", "keywords", "name of the output files without extension; .csv and .jsonl are added")
+	formats := fs.String("format", "csv,json", "comma separated formats to write: csv, json")
+	top := fs.Int("top", 10, "number of terms and of bigrams to keep for every article and section")
+	stopList := fs.String("stop-words", "english", `comma separated stop word lists: "english", "none" or a file of words`)
+	withSections := fs.Bool("sections", true, "also extract the terms of every section")
+	fs.Parse(args)
+
+	if *top < 1 {
+		fmt.Println("Error: -top must be at least 1")
+		return 2
+	}
+	wanted := map[string]bool{}
+	for _, name := range splitList(*formats) {
+		wanted[name] = true
+	}
+	for _, f := range keywordFormats {
+		delete(wanted, f.name)
+	}
+	for name := range wanted {
+		fmt.Printf("Error: unknown format %q, want csv or json\n", name)
+		return 2
+	}
+	stop, err := loadStopWords(*stopList)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 2
+	}
+
+	records, err := readRecords(*input)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	keywords := extractKeywords(records, stop, *top, *withSections)
+
+	for _, name := range splitList(*formats) {
+		for _, f := range keywordFormats {
+			if f.name != name {
+				continue
+			}
+			fileName := *output + f.suffix
+			file, err := os.Create(fileName)
+			if err != nil {
+				fmt.Printf("Error creating file: %v\n", err)
+				return 1
+			}
+			err = f.write(file, keywords)
+			if closeErr := file.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				fmt.Printf("Error writing %s: %v\n", fileName, err)
+				return 1
+			}
+			fmt.Printf("Wrote %s\n", fileName)
+		}
+	}
+
+	for _, a := range keywords {
+		var terms []string
+		for _, t := range a.Terms {
+			terms = append(terms, t.Term)
+		}
+		fmt.Printf("- %s: %s\n", a.Title, strings.Join(terms, ", "))
+	}
+	return 0
+}
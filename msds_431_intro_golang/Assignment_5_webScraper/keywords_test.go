@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCountTerms(t *testing.T) {
+	counts := countTerms([]string{
+		"Industrial robots weld car bodies. Industrial robots paint them in 1961.",
+		"A robot arm.",
+	}, englishStopWords)
+	wantWords := map[string]int{"industrial": 2, "robots": 2, "weld": 1, "car": 1, "bodies": 1, "paint": 1, "robot": 1, "arm": 1}
+	if !reflect.DeepEqual(counts.words, wantWords) {
+		t.Errorf("words = %v, want %v", counts.words, wantWords)
+	}
+	// "bodies industrial" spans two sentences and "paint them" a stop
+	// word, so neither is a bigram.
+	wantBigrams := map[string]int{"industrial robots": 2, "robots weld": 1, "weld car": 1, "car bodies": 1, "robots paint": 1, "robot arm": 1}
+	if !reflect.DeepEqual(counts.bigrams, wantBigrams) {
+		t.Errorf("bigrams = %v, want %v", counts.bigrams, wantBigrams)
+	}
+	if counts.totalWords != 10 || counts.totalBigrams != 7 {
+		t.Errorf("totals = %d words, %d bigrams, want 10 and 7", counts.totalWords, counts.totalBigrams)
+	}
+}
+
+// keywordCorpus has three articles that all mention robots; only one of
+// them mentions welding.
+func keywordCorpus() []WebsiteData {
+	return []WebsiteData{
+		treeRecord("https://en.wikipedia.org/wiki/Welding_robot", "Welding robot",
+			section("main_summary", 1, "Welding robots weld car bodies. Robots weld quickly."),
+			section("Safety", 2, "Robots need safety cages.")),
+		treeRecord("https://en.wikipedia.org/wiki/Robot", "Robot",
+			section("main_summary", 1, "Robots are machines. Robots move.")),
+		treeRecord("https://en.wikipedia.org/wiki/Android", "Android",
+			section("main_summary", 1, "Androids are robots that look human.")),
+	}
+}
+
+func TestExtractKeywords(t *testing.T) {
+	keywords := extractKeywords(keywordCorpus(), englishStopWords, 2, true)
+	if len(keywords) != 3 {
+		t.Fatalf("got keywords for %d articles, want 3", len(keywords))
+	}
+	welding := keywords[0]
+	if welding.URL != "https://en.wikipedia.org/wiki/Welding_robot" || len(welding.Terms) != 2 {
+		t.Fatalf("welding keywords = %+v", welding)
+	}
+	// "weld" is as frequent as "robots" in the article but occurs in no
+	// other article, so it ranks first.
+	if welding.Terms[0].Term != "weld" || welding.Terms[1].Term != "robots" || welding.Terms[0].Score <= welding.Terms[1].Score {
+		t.Errorf("welding terms = %+v, want weld before robots", welding.Terms)
+	}
+	if len(welding.Bigrams) != 2 || welding.Bigrams[0].Term != "robots weld" {
+		t.Errorf("welding bigrams = %+v", welding.Bigrams)
+	}
+
+	var paths []string
+	for _, sec := range welding.Sections {
+		paths = append(paths, strings.Join(sec.SectionPath, " > "))
+	}
+	if !reflect.DeepEqual(paths, []string{"main_summary", "Safety"}) {
+		t.Errorf("section paths = %q", paths)
+	}
+	if got := welding.Sections[1].Terms; len(got) != 2 || got[0].Term != "cages" {
+		t.Errorf("Safety terms = %+v", got)
+	}
+
+	if keywords := extractKeywords(keywordCorpus(), englishStopWords, 2, false); keywords[0].Sections != nil {
+		t.Errorf("sections extracted with withSections false: %+v", keywords[0].Sections)
+	}
+}
+
+func TestLoadStopWords(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "stop.txt")
+	if err := os.WriteFile(file, []byte("Robot robots\nweld\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	stop, err := loadStopWords("english," + file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !stop["the"] || !stop["robot"] || !stop["weld"] {
+		t.Errorf("combined list lacks words: the %v, robot %v, weld %v", stop["the"], stop["robot"], stop["weld"])
+	}
+	if stop, _ := loadStopWords("none"); len(stop) != 0 {
+		t.Errorf("none gave %d stop words", len(stop))
+	}
+	if _, err := loadStopWords(filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Error("a missing stop word file gave no error")
+	}
+
+	keywords := extractKeywords(keywordCorpus(), stop, 1, false)
+	if keywords[0].Terms[0].Term == "robots" || keywords[0].Terms[0].Term == "weld" {
+		t.Errorf("top term %q is a stop word", keywords[0].Terms[0].Term)
+	}
+}
+
+func TestRunKeywords(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "data.jsonl")
+	var lines []string
+	for _, data := range keywordCorpus() {
+		lines = append(lines, mustJSON(t, data))
+	}
+	if err := os.WriteFile(input, []byte(strings.Join(lines, "\n")+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	output := filepath.Join(dir, "keywords")
+	if code := runKeywords([]string{"-input", input, "-output", output, "-top", "1"}); code != 0 {
+		t.Fatalf("runKeywords returned %d", code)
+	}
+	raw, err := os.ReadFile(output + ".csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(bytes.NewReader(raw)).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(rows[0], []string{"url", "title", "section", "kind", "rank", "term", "score"}) {
+		t.Errorf("header = %q", rows[0])
+	}
+	if row := rows[1]; row[1] != "Welding robot" || row[2] != "" || row[3] != "term" || row[4] != "1" || row[5] != "weld" {
+		t.Errorf("first row = %q", row)
+	}
+	raw, err = os.ReadFile(output + ".jsonl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(raw), "\n"); n != 3 {
+		t.Errorf("JSON output has %d lines, want 3", n)
+	}
+
+	if code := runKeywords([]string{"-input", input, "-output", output, "-format", "xml"}); code != 2 {
+		t.Errorf("runKeywords with -format xml returned %d, want 2", code)
+	}
+}
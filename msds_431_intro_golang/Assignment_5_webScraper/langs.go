@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// alignedFileName is where --langs writes the language editions of every
+// seed article, one group per line.
+const alignedFileName = "wikipedia_aligned.jsonl"
+
+// AlignedArticle groups the language editions of one seed article under
+// a shared key: the Wikidata item id when the page links to one,
+// otherwise "<language>:<title>" of the seed.
+type AlignedArticle struct {
+	Key      string                 `json:"key"`
+	Seed     string                 `json:"seed"`
+	Articles map[string]WebsiteData `json:"articles"` // language code -> record
+	Missing  []string               `json:"missing,omitempty"`
+}
+
+var wikidataItem = regexp.MustCompile(`\bQ[0-9]+$`)
+
+// wikidataID extracts the item id from a Wikidata link such as
+// https://www.wikidata.org/wiki/Special:EntityPage/Q170978.
+func wikidataID(href string) string {
+	return wikidataItem.FindString(href)
+}
+
+// parseLangLinks returns the interlanguage links of a page, keyed by
+// language code.
+func parseLangLinks(doc *goquery.Selection) map[string]string {
+	links := map[string]string{}
+	doc.Find("li.interlanguage-link a.interlanguage-link-target[href]").Each(func(_ int, a *goquery.Selection) {
+		lang := firstNonEmpty(a.AttrOr("hreflang", ""), a.AttrOr("lang", ""))
+		if lang != "" {
+			links[lang] = a.AttrOr("href", "")
+		}
+	})
+	if len(links) == 0 {
+		return nil
+	}
+	return links
+}
+
+// articleLanguage returns the language of a record, falling back to the
+// subdomain of its wiki, e.g. "de" for de.wikipedia.org.
+func articleLanguage(data WebsiteData) string {
+	if data.Language != "" {
+		return data.Language
+	}
+	u, err := url.Parse(data.URL)
+	if err != nil {
+		return ""
+	}
+	lang, _, _ := strings.Cut(u.Hostname(), ".")
+	return lang
+}
+
+// alignKey returns the key that groups the editions of data.
+func alignKey(data WebsiteData) string {
+	if data.WikidataID != "" {
+		return data.WikidataID
+	}
+	return articleLanguage(data) + ":" + data.Title
+}
+
+// scrapeLanguages scrapes the editions in langs of every seed article,
+// writing their records to w like the seeds, and groups each seed with its
+// editions. Groups follow the order of seedURLs; languages a seed has no
+// link for are listed as missing. When ctx is cancelled before every
+// edition was fetched, the groups that lack one are left out rather than
+// listing it as missing.
+func scrapeLanguages(ctx context.Context, seedURLs []string, seeds []WebsiteData, langs []string, w io.Writer, opts scrapeOptions) []AlignedArticle {
+	bySeed := map[string]WebsiteData{}
+	for _, data := range seeds {
+		bySeed[data.URL] = data
+	}
+
+	var groups []AlignedArticle
+	var urls []string
+	want := map[string]bool{}
+	for _, seedURL := range seedURLs {
+		seed, ok := bySeed[seedURL]
+		if !ok {
+			continue
+		}
+		group := AlignedArticle{
+			Key:      alignKey(seed),
+			Seed:     seed.URL,
+			Articles: map[string]WebsiteData{articleLanguage(seed): seed},
+		}
+		for _, lang := range langs {
+			if _, ok := group.Articles[lang]; ok {
+				continue
+			}
+			link := seed.LangLinks[lang]
+			if link == "" {
+				group.Missing = append(group.Missing, lang)
+				continue
+			}
+			if !want[link] {
+				want[link] = true
+				urls = append(urls, link)
+			}
+		}
+		groups = append(groups, group)
+	}
+
+	fmt.Printf("\nScraping %d language editions (%s)\n", len(urls), strings.Join(langs, ", "))
+	editions := map[string]WebsiteData{}
+	for _, data := range scrape(ctx, urls, w, opts) {
+		editions[data.URL] = data
+	}
+	interrupted := ctx.Err() != nil
+
+	complete := groups[:0]
+	for i := range groups {
+		seed := bySeed[groups[i].Seed]
+		missing := groups[i].Missing
+		partial := false
+		for _, lang := range langs {
+			link := seed.LangLinks[lang]
+			if _, done := groups[i].Articles[lang]; done || link == "" {
+				continue
+			}
+			data, ok := editions[link]
+			if !ok && interrupted {
+				partial = true
+				break
+			}
+			if !ok {
+				missing = append(missing, lang)
+				continue
+			}
+			if data.WikidataID != "" && seed.WikidataID != "" && data.WikidataID != seed.WikidataID {
+				fmt.Printf("Warning: %s links to %s, which is Wikidata item %s, not %s\n", seed.URL, link, data.WikidataID, seed.WikidataID)
+			}
+			groups[i].Articles[lang] = data
+		}
+		if partial {
+			continue
+		}
+		groups[i].Missing = missing
+		complete = append(complete, groups[i])
+	}
+	return complete
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+// hostRewriter sends every request to target, so that absolute links to
+// other wikis reach the fixture server.
+type hostRewriter struct {
+	target *url.URL
+}
+
+func (h hostRewriter) RoundTrip(req *http.Request) (*http.Response, error) {
+	r := req.Clone(req.Context())
+	r.URL.Scheme = h.target.Scheme
+	r.URL.Host = h.target.Host
+	r.Host = ""
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func TestParseLocalizedHeadings(t *testing.T) {
+	tests := []struct {
+		name, pageURL, lang, title string
+		want                       []string
+	}{
+		{"robotik_de", "https://de.wikipedia.org/wiki/Robotik", "de", "Robotik",
+			[]string{"1:main_summary", "2:Geschichte#Geschichte", "3:Frühe Roboter#Frühe_Roboter", "2:Einzelnachweise#Einzelnachweise"}},
+		{"robotique_fr", "https://fr.wikipedia.org/wiki/Robotique", "fr", "Robotique",
+			[]string{"1:main_summary", "2:Histoire#Histoire"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := parseFixture(t, tt.name, tt.pageURL)
+			if data.Title != tt.title || data.Language != tt.lang || data.WikidataID != "Q170978" {
+				t.Errorf("title/language/wikidata = %q/%q/%q", data.Title, data.Language, data.WikidataID)
+			}
+
+			var got []string
+			var walk func(secs []*Section)
+			walk = func(secs []*Section) {
+				for _, sec := range secs {
+					entry := fmt.Sprintf("%d:%s", sec.Level, sec.Title)
+					if sec.Anchor != "" {
+						entry += "#" + sec.Anchor
+					}
+					got = append(got, entry)
+					walk(sec.Children)
+				}
+			}
+			walk(data.SectionTree)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("sections = %v, want %v", got, tt.want)
+			}
+			if n := len(data.Sections[1].Paragraphs); n != 1 {
+				t.Errorf("%s has %d paragraphs, want 1", data.Sections[1].Title, n)
+			}
+		})
+	}
+}
+
+func TestTableFileBaseLanguages(t *testing.T) {
+	tests := []struct{ pageURL, want string }{
+		{"https://en.wikipedia.org/wiki/Chatbot", "tables/Chatbot_table1"},
+		{"https://de.wikipedia.org/wiki/Chatbot", "tables/de_Chatbot_table1"},
+		{"http://127.0.0.1:8080/wiki/Chatbot", "tables/Chatbot_table1"},
+	}
+	for _, tt := range tests {
+		if got := tableFileBase(tt.pageURL, 1); got != tt.want {
+			t.Errorf("tableFileBase(%s) = %q, want %q", tt.pageURL, got, tt.want)
+		}
+	}
+}
+
+func TestScrapeLanguages(t *testing.T) {
+	srv := newFixtureServer(t)
+	target, _ := url.Parse(srv.URL)
+	opts := scrapeOptions{outDir: t.TempDir(), transport: hostRewriter{target}}
+
+	seedURLs := []string{"https://en.wikipedia.org/wiki/Robotics", "https://en.wikipedia.org/wiki/Chatbot"}
+	var buf bytes.Buffer
+	seeds := scrape(context.Background(), seedURLs, &buf, opts)
+	groups := scrapeLanguages(context.Background(), seedURLs, seeds, []string{"de", "fr", "es"}, &buf, opts)
+
+	if len(groups) != 2 {
+		t.Fatalf("got %d groups, want 2", len(groups))
+	}
+	robotics := groups[0]
+	if robotics.Key != "Q170978" || robotics.Seed != seedURLs[0] {
+		t.Errorf("group key/seed = %q/%q", robotics.Key, robotics.Seed)
+	}
+	for lang, title := range map[string]string{"en": "Robotics", "de": "Robotik", "fr": "Robotique"} {
+		if got := robotics.Articles[lang].Title; got != title {
+			t.Errorf("%s edition title = %q, want %q", lang, got, title)
+		}
+	}
+	if !reflect.DeepEqual(robotics.Missing, []string{"es"}) {
+		t.Errorf("missing = %v, want [es]", robotics.Missing)
+	}
+
+	chatbot := groups[1]
+	if chatbot.Key != "en:Chatbot" || len(chatbot.Articles) != 1 {
+		t.Errorf("chatbot group = %q with %d articles", chatbot.Key, len(chatbot.Articles))
+	}
+	if !reflect.DeepEqual(chatbot.Missing, []string{"de", "fr", "es"}) {
+		t.Errorf("missing = %v, want [de fr es]", chatbot.Missing)
+	}
+
+	// The editions are written to the main output after the seeds.
+	if lines := bytes.Count(buf.Bytes(), []byte("\n")); lines != 4 {
+		t.Errorf("output has %d records, want 4", lines)
+	}
+}
+
+// TestScrapeLanguagesInterrupted cancels the crawl when the first edition
+// is requested. The article whose other edition was never fetched is
+// left out instead of listing that language as missing.
+func TestScrapeLanguagesInterrupted(t *testing.T) {
+	srv := newFixtureServer(t)
+	target, _ := url.Parse(srv.URL)
+	seedOpts := scrapeOptions{outDir: t.TempDir(), transport: hostRewriter{target}}
+	seedURLs := []string{"https://en.wikipedia.org/wiki/Robotics", "https://en.wikipedia.org/wiki/Chatbot"}
+	seeds := scrape(context.Background(), seedURLs, &bytes.Buffer{}, seedOpts)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	opts := seedOpts
+	opts.transport = cancelOnRequest{cancel: cancel, next: hostRewriter{target}}
+	groups := scrapeLanguages(ctx, seedURLs, seeds, []string{"de", "fr"}, &bytes.Buffer{}, opts)
+
+	// Chatbot links to neither edition, so its group is complete.
+	if len(groups) != 1 || groups[0].Seed != seedURLs[1] {
+		t.Fatalf("groups = %+v, want only the Chatbot group", groups)
+	}
+	if !reflect.DeepEqual(groups[0].Missing, []string{"de", "fr"}) {
+		t.Errorf("missing = %v, want [de fr]", groups[0].Missing)
+	}
+}
+
+// cancelOnRequest cancels a context as soon as a request is sent.
+type cancelOnRequest struct {
+	cancel context.CancelFunc
+	next   http.RoundTripper
+}
+
+func (c cancelOnRequest) RoundTrip(req *http.Request) (*http.Response, error) {
+	c.cancel()
+	return c.next.RoundTrip(req)
+}
@@ -2,35 +2,231 @@ package main
 
 import (
 	"bufio"
+	"bytes"
+	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
+	"io"
+	"net/http"
 	"os"
+	"os/signal"
+	"sort"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/gocolly/colly"
 )
 
-type ParagraphSection struct {
-	Paragraphs []string `json:"paragraph"`
-}
+var (
+	cacheDir = flag.String("cache-dir", "", "directory for the on-disk HTTP cache (disabled when empty)")
+	offline  = flag.Bool("offline", false, "serve pages only from the cache, never from the network")
+
+	category      = flag.String("category", "", `scrape the articles of a category, e.g. "Category:Robotics", instead of the built-in URLs`)
+	categoryDepth = flag.Int("category-depth", 0, "how many levels of subcategories to follow with --category")
+	wikiBase      = flag.String("wiki", "https://en.wikipedia.org", "base URL of the wiki used by --category")
+
+	source = flag.String("source", "html", "how to fetch articles: html (scrape the article pages) or api (MediaWiki action=parse)")
+
+	userAgent    = flag.String("user-agent", defaultUserAgent, "User-Agent sent with every request and matched against robots.txt")
+	contact      = flag.String("contact", "", "contact URL or e-mail added to the User-Agent, e.g. mailto:team@example.com")
+	ignoreRobots = flag.Bool("ignore-robots", false, "do not read or obey robots.txt")
+	crawlDelay   = flag.Duration("crawl-delay", -1, "delay between requests to the same host; negative uses the robots.txt Crawl-delay")
+	allowDomains = flag.String("allow-domains", "", "comma separated domains to crawl; all others are skipped")
+	denyDomains  = flag.String("deny-domains", "", "comma separated domains never to crawl")
+
+	sink = flag.String("sink", "", "also store articles in a database, e.g. sqlite:wikipedia.db")
+
+	resume = flag.Bool("resume", false, "scrape only the pending URLs of an interrupted run and append to its output")
+
+	langs = flag.String("langs", "", "comma separated language editions to scrape for every article, e.g. de,fr,es")
+
+	profiles = flag.String("profiles", "", "JSON site profile, or a directory of them, with the selectors for non-Wikipedia sites")
+
+	order = flag.String("order", "completion", "order of the records in the output: completion (as pages finish), input (the order of the URLs) or url (sorted by URL)")
+
+	metricsAddr = flag.String("metrics-addr", "", "serve Prometheus metrics at /metrics on this address during the run, e.g. :9090")
+
+	summarySentences = flag.Int("summary-sentences", 3, "sentences in the summary of every article and of every longer section; 0 writes no summaries")
+
+	warcFile = flag.String("warc", "", "also archive every request and response in this WARC file, e.g. wikipedia_pages.warc.gz")
+)
+
+// SchemaVersion is the version of the record layout written by the
+// scraper. Records without a schema_version predate it; readRecords and
+// the migrate command convert them.
+const SchemaVersion = 2
 
-type Content struct {
-	Sections []map[string]ParagraphSection `json:"sections"`
+// SectionRecord is one entry of the ordered "sections" array: a heading
+// of the article, in document order, with the paragraphs directly below
+// it. Level is 1 for the lead and 2..6 for h2..h6.
+type SectionRecord struct {
+	Title      string   `json:"title"`
+	Level      int      `json:"level"`
+	Paragraphs []string `json:"paragraphs"`
+	Summary    string   `json:"summary,omitempty"` // only for sections longer than the summary
 }
 
 type WebsiteData struct {
-	URL     string  `json:"url"` // Added URL field
-	Title   string  `json:"title"`
-	Content Content `json:"sections"`
+	SchemaVersion int               `json:"schema_version"`
+	URL           string            `json:"url"` // Added URL field
+	Title         string            `json:"title"`
+	Language      string            `json:"language,omitempty"`
+	WikidataID    string            `json:"wikidata_id,omitempty"`
+	LangLinks     map[string]string `json:"lang_links,omitempty"` // language code -> article URL
+	OutLinks      []OutLink         `json:"out_links,omitempty"`  // wiki pages linked from anywhere in the content
+	Graph         *GraphScores      `json:"graph,omitempty"`      // set by the graph command
+	Summary       string            `json:"summary,omitempty"`    // highest ranked sentences of the article
+	Sections      []SectionRecord   `json:"sections"`
+	SectionTree   []*Section        `json:"section_tree"`
+}
+
+// scrapeOptions controls how scrape fetches pages and where it puts the
+// files that accompany the JSON lines output.
+type scrapeOptions struct {
+	outDir    string            // table files are written below this directory
+	transport http.RoundTripper // nil means the collector's default transport
+	source    string            // "html" scrapes article pages, "api" uses the MediaWiki API
+	userAgent string            // empty means the collector's default
+	policy    *crawlPolicy      // nil fetches every URL without delay
+	sink      recordSink        // nil writes only the JSON lines output
+	metrics   *crawlMetrics     // nil records no metrics
+	profiles  []*SiteProfile    // site profiles tried before the built-in Wikipedia one
+	order     string            // record order, one of the order* constants; empty means orderCompletion
+	summary   int               // sentences per summary; 0 writes no summaries
+}
+
+// Orders in which scrape writes its records. Fetches are concurrent in
+// every order; the input and url orders hold the records back until the
+// last page is done, so that the same pages give the same output.
+const (
+	orderCompletion = "completion"
+	orderInput      = "input"
+	orderURL        = "url"
+)
+
+// newCollector returns a collector that uses the transport and identity
+// from opts. robots.txt is handled by opts.policy, not by colly.
+func newCollector(opts scrapeOptions) *colly.Collector {
+	c := colly.NewCollector()
+	if opts.transport != nil {
+		c.WithTransport(opts.transport)
+	}
+	if opts.userAgent != "" {
+		c.UserAgent = opts.userAgent
+	}
+	return c
 }
 
-type SectionInfo struct {
-	Title      string
-	Paragraphs []string
+// commands are the subcommands selected by the first argument. Without
+// one, the program scrapes the configured URLs.
+var commands = map[string]func(args []string) int{
+	"dedup":     runDedup,
+	"diff":      runDiff,
+	"export":    runExport,
+	"graph":     runGraph,
+	"index":     runIndex,
+	"keywords":  runKeywords,
+	"migrate":   runMigrate,
+	"replay":    runReplay,
+	"search":    runSearch,
+	"summarize": runSummarize,
+	"verify":    runVerify,
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		if cmd, ok := commands[os.Args[1]]; ok {
+			os.Exit(cmd(os.Args[2:]))
+		}
+	}
+	flag.Parse()
+	os.Exit(runScrape())
+}
+
+// runScrape scrapes the configured URLs and returns the exit code. The
+// first SIGINT or SIGTERM stops scheduling new pages; pages in flight
+// finish or time out, the output is flushed and the crawl state is saved
+// so that --resume can pick up the pending URLs.
+func runScrape() int {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	// returned is closed before stop cancels ctx on the way out, so that
+	// only a signal prints the message.
+	returned := make(chan struct{})
+	defer close(returned)
+	go func() {
+		<-ctx.Done()
+		select {
+		case <-returned:
+			return
+		default:
+		}
+		// A second signal kills the program right away.
+		stop()
+		fmt.Println("\nInterrupted: finishing pages in flight, press Ctrl-C again to quit")
+	}()
+
+	opts := scrapeOptions{outDir: ".", source: *source, order: *order, summary: *summarySentences}
+	if *source != "html" && *source != "api" {
+		fmt.Printf("Error: unknown --source %q, want html or api\n", *source)
+		return 2
+	}
+	if *order != orderCompletion && *order != orderInput && *order != orderURL {
+		fmt.Printf("Error: unknown --order %q, want completion, input or url\n", *order)
+		return 2
+	}
+	if *offline && *cacheDir == "" {
+		fmt.Println("Error: --offline requires --cache-dir")
+		return 2
+	}
+	if *cacheDir != "" {
+		transport, err := newCachingTransport(*cacheDir, *offline)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		}
+		opts.transport = transport
+	}
+	if *warcFile != "" {
+		// A resumed run adds its pages to the archive of the first one.
+		archive, err := newWARCWriter(*warcFile, *resume)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		}
+		defer archive.Close()
+		opts.transport = &warcTransport{archive: archive, next: opts.transport}
+	}
+
+	opts.userAgent = userAgentString(*userAgent, *contact)
+	opts.policy = newCrawlPolicy(opts.userAgent, opts.transport)
+	// Offline runs never reach the sites, so robots.txt does not apply.
+	opts.policy.ignoreRobots = *ignoreRobots || *offline
+	opts.policy.crawlDelay = *crawlDelay
+	opts.policy.allowed = splitList(*allowDomains)
+	opts.policy.denied = splitList(*denyDomains)
+
+	if *profiles != "" {
+		loaded, err := loadSiteProfiles(*profiles)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 2
+		}
+		opts.profiles = loaded
+	}
+
+	if *sink != "" {
+		store, err := openSink(*sink)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 2
+		}
+		defer store.Close()
+		opts.sink = store
+	}
+
 	urls := []string{
 		"https://en.wikipedia.org/wiki/Robotics",
 		"https://en.wikipedia.org/wiki/Robot",
@@ -44,120 +240,272 @@ func main() {
 		"https://en.wikipedia.org/wiki/Android_(robot)",
 	}
 
-	// Create and open the output file
-	file, err := os.Create("wikipedia_data.jsonl")
+	// state holds the URLs of the whole crawl, which verification expects
+	// records for. A resumed run scrapes only the pending ones and keeps
+	// the ones earlier runs completed.
+	var state crawlState
+	if *resume {
+		var err error
+		state, err = loadCrawlState(stateFileName)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		}
+		fmt.Printf("Resuming: %d pages done, %d pending\n", len(state.Completed), len(state.Pending))
+		urls = state.Pending
+	} else if *category != "" {
+		var members []string
+		var err error
+		if opts.source == "api" {
+			members, err = newAPIClient(*wikiBase, opts).categoryMembers(ctx, *category, *categoryDepth)
+		} else {
+			members, err = crawlCategory(ctx, categoryURL(*wikiBase, *category), *categoryDepth, opts)
+		}
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		}
+		fmt.Printf("Found %d articles in %s\n", len(members), *category)
+		urls = members
+	}
+	if !*resume {
+		state = crawlState{Pending: urls}
+	}
+	seedURLs := state.urls()
+
+	// Create and open the output file. A resumed run appends to it.
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if *resume {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	}
+	file, err := os.OpenFile("wikipedia_data.jsonl", flags, 0o644)
 	if err != nil {
 		fmt.Printf("Error creating file: %v\n", err)
-		return
+		return 1
 	}
 	defer file.Close()
 
 	writer := bufio.NewWriter(file)
 	defer writer.Flush()
 
+	opts.metrics = newCrawlMetrics()
+	if *metricsAddr != "" {
+		stopMetrics, err := serveMetrics(*metricsAddr, opts.metrics)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		}
+		defer stopMetrics()
+		fmt.Printf("Serving metrics at http://%s/metrics\n", *metricsAddr)
+	}
+	// The report is written however the run ends, so an interrupted run
+	// still shows what it fetched.
+	defer func() {
+		if err := opts.metrics.writeReport(reportFileName); err != nil {
+			fmt.Printf("Error: %v\n", err)
+		}
+	}()
+
+	seeds := scrape(ctx, urls, writer, opts)
+	if err := writer.Flush(); err != nil {
+		fmt.Printf("Error writing wikipedia_data.jsonl: %v\n", err)
+		return 1
+	}
+
+	state = state.advance(seeds)
+	if err := state.save(stateFileName); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	if ctx.Err() != nil {
+		fmt.Printf("\nStopped with %d pages done and %d pending; %s lists them.\n", len(state.Completed), len(state.Pending), stateFileName)
+		fmt.Println("Run again with --resume to scrape the pending pages.")
+		return 130
+	}
+
+	if languages := splitList(*langs); len(languages) > 0 {
+		groups := scrapeLanguages(ctx, urls, seeds, languages, writer, opts)
+		if err := writeJSONLFile(alignedFileName, groups); err != nil {
+			fmt.Printf("Error: %v\n", err)
+		} else {
+			fmt.Printf("\nAligned %d articles in %s\n", len(groups), alignedFileName)
+		}
+		if ctx.Err() != nil {
+			if err := writer.Flush(); err != nil {
+				fmt.Printf("Error writing wikipedia_data.jsonl: %v\n", err)
+				return 1
+			}
+			fmt.Println("\nStopped while scraping language editions; articles whose editions were not all fetched are not aligned.")
+			fmt.Println("The seed articles are done; run again with --langs to align the others.")
+			return 130
+		}
+	}
+
+	if err := writer.Flush(); err != nil {
+		fmt.Printf("Error writing wikipedia_data.jsonl: %v\n", err)
+		return 1
+	}
+	fmt.Println("\nAll data written to wikipedia_data.jsonl")
+
+	result, err := verifyOutput("wikipedia_data.jsonl", seedURLs)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	result.printSummary(os.Stdout, "wikipedia_data.jsonl")
+	if result.failed() {
+		return 1
+	}
+	return 0
+}
+
+// scrape fetches every URL concurrently, writes one JSON line per article
+// to w and returns the records in the order they were written, which is
+// set by opts.order. Once ctx is cancelled no new page is started, and
+// scrape returns when the pages in flight are done.
+func scrape(ctx context.Context, urls []string, w io.Writer, opts scrapeOptions) []WebsiteData {
 	var mu sync.Mutex
+	var records []WebsiteData
+	ordered := opts.order != "" && opts.order != orderCompletion
+
+	// save writes the tables of an article and appends its record to w,
+	// or keeps it for later when the output is ordered.
+	save := func(data WebsiteData) {
+		fmt.Printf("\n=== Processing %s: Found main title: %s ===\n", data.URL, data.Title)
+		finishRecord(&data, opts)
+
+		// Marshal to JSON
+		jsonData, err := json.Marshal(data)
+		if err != nil {
+			fmt.Printf("Error marshaling JSON for %s: %v\n", data.URL, err)
+			return
+		}
+
+		// Write to file with mutex
+		mu.Lock()
+		if !ordered {
+			w.Write(jsonData)
+			io.WriteString(w, "\n")
+		}
+		records = append(records, data)
+		mu.Unlock()
+
+		if opts.sink != nil {
+			if err := opts.sink.put(data); err != nil {
+				fmt.Printf("Error storing %s: %v\n", data.URL, err)
+			}
+		}
+
+		fmt.Printf("Completed processing %s\n", data.URL)
+	}
+
+	if opts.source == "api" {
+		scrapeAPI(ctx, urls, opts, save)
+	} else {
+		scrapeHTML(ctx, urls, opts, save)
+	}
+
+	if ordered {
+		sortRecords(records, urls, opts.order)
+		if err := writeJSONL(w, records); err != nil {
+			fmt.Printf("Error writing the records: %v\n", err)
+		}
+	}
+	return records
+}
+
+// finishRecord adds the summaries to a parsed article and writes its
+// tables below opts.outDir. Scraped and replayed records both go through
+// it, so that the same pages give the same output.
+func finishRecord(data *WebsiteData, opts scrapeOptions) {
+	summarizeRecord(data, opts.summary)
+	if err := writeTables(opts.outDir, data.SectionTree); err != nil {
+		fmt.Printf("Error writing tables for %s: %v\n", data.URL, err)
+	}
+}
+
+// sortRecords puts records in the order of their URL in urls, or sorted by
+// URL. Records of the same URL keep the order they were saved in.
+func sortRecords(records []WebsiteData, urls []string, order string) {
+	position := map[string]int{}
+	for i, u := range urls {
+		if _, ok := position[u]; !ok {
+			position[u] = i
+		}
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		if order == orderURL {
+			return records[i].URL < records[j].URL
+		}
+		return position[records[i].URL] < position[records[j].URL]
+	})
+}
+
+// scrapeHTML fetches the article pages at urls and passes each record to
+// save. No new page is started once ctx is cancelled.
+func scrapeHTML(ctx context.Context, urls []string, opts scrapeOptions, save func(WebsiteData)) {
 	var wg sync.WaitGroup
 
 	// Process each URL
-	for _, url := range urls {
+	for _, pageURL := range urls {
+		if ctx.Err() != nil {
+			break
+		}
+		if err := opts.policy.check(pageURL); err != nil {
+			fmt.Printf("Skipping %s: %v\n", pageURL, err)
+			continue
+		}
 		wg.Add(1)
 		time.Sleep(100 * time.Millisecond)
 
-		go func(url string) {
+		go func(pageURL string) {
 			defer wg.Done()
-
-			c := colly.NewCollector()
-
-			var sections []SectionInfo
-			currentSection := SectionInfo{
-				Title:      "main_summary",
-				Paragraphs: []string{},
+			if err := opts.policy.wait(ctx, pageURL); err != nil {
+				return
 			}
-			var pageTitle string
 
-			c.OnHTML(".mw-page-title-main", func(e *colly.HTMLElement) {
-				pageTitle = e.Text
-				fmt.Printf("\n=== Processing %s: Found main title: %s ===\n", url, pageTitle)
-			})
+			pageOpts := opts
+			pageOpts.transport = &pageTransport{pageURL: pageURL, next: opts.transport}
+			c := newCollector(pageOpts)
+			m := pageMetrics{URL: pageURL}
+			var start time.Time
 
-			c.OnHTML("#mw-content-text", func(e *colly.HTMLElement) {
-				e.ForEach("*", func(_ int, el *colly.HTMLElement) {
-					if el.Name == "div" && el.Attr("class") == "mw-heading mw-heading2" {
-						if len(currentSection.Paragraphs) > 0 {
-							sections = append(sections, currentSection)
-						}
-						currentSection = SectionInfo{
-							Title:      el.ChildText("h2"),
-							Paragraphs: []string{},
-						}
-					}
-
-					if el.Name == "p" {
-						text := el.Text
-						if text != "" && text != "\n" {
-							currentSection.Paragraphs = append(currentSection.Paragraphs, text)
-						}
-					}
-				})
+			c.OnRequest(func(*colly.Request) {
+				start = time.Now()
 			})
 
-			c.OnScraped(func(r *colly.Response) {
-				if len(currentSection.Paragraphs) > 0 {
-					sections = append(sections, currentSection)
-				}
-
-				var finalSections []map[string]ParagraphSection
-				for _, section := range sections {
-					sectionMap := map[string]ParagraphSection{
-						section.Title: {
-							Paragraphs: section.Paragraphs,
-						},
-					}
-					finalSections = append(finalSections, sectionMap)
-				}
-
-				// Create single website data object
-				data := WebsiteData{
-					URL:   url,
-					Title: pageTitle,
-					Content: Content{
-						Sections: finalSections,
-					},
-				}
-
-				// Marshal to JSON
-				jsonData, err := json.Marshal(data)
+			c.OnResponse(func(r *colly.Response) {
+				m.Status, m.Bytes, m.FetchMillis = r.StatusCode, len(r.Body), millisSince(start)
+				parseStart := time.Now()
+				data, err := ParseArticle(bytes.NewReader(r.Body), pageURL, opts.profiles...)
+				m.ParseMillis = millisSince(parseStart)
 				if err != nil {
-					fmt.Printf("Error marshaling JSON for %s: %v\n", url, err)
+					fmt.Printf("Error parsing %s: %v\n", pageURL, err)
+					m.Error = err.Error()
 					return
 				}
+				m.setCounts(data)
+				save(data)
+			})
 
-				// Write to file with mutex
-				mu.Lock()
-				writer.Write(jsonData)
-				writer.WriteString("\n")
-				mu.Unlock()
-
-				fmt.Printf("Completed processing %s\n", url)
+			c.OnError(func(r *colly.Response, err error) {
+				m.Status, m.Bytes = r.StatusCode, len(r.Body)
+				// A request that failed before it was sent has no fetch time.
+				if !start.IsZero() {
+					m.FetchMillis = millisSince(start)
+				}
+				m.Error = err.Error()
 			})
 
-			c.Visit(url)
-		}(url)
+			if err := c.Visit(pageURL); err != nil {
+				fmt.Printf("Error visiting %s: %v\n", pageURL, err)
+				if m.Error == "" {
+					m.Error = err.Error()
+				}
+			}
+			opts.metrics.record(m)
+		}(pageURL)
 	}
 
 	wg.Wait()
-
-	fmt.Println("\nAll data written to wikipedia_data.jsonl")
-	fmt.Println("\nSummary of completed scraping:")
-
-	// Read and parse the file to show summary
-	file.Seek(0, 0)
-	scanner := bufio.NewScanner(file)
-	count := 0
-	for scanner.Scan() {
-		count++
-		var data WebsiteData
-		json.Unmarshal(scanner.Bytes(), &data)
-		fmt.Printf("- %s: %s (Sections: %d)\n", data.URL, data.Title, len(data.Content.Sections))
-	}
 }
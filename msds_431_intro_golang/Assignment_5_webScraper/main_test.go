@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+// fixturePages maps request paths, including the query for paginated
+// pages, to the saved pages in testdata.
+var fixturePages = map[string]string{
+	"/wiki/Robotics":          "robotics",
+	"/wiki/Chatbot":           "chatbot",
+	"/wiki/Robotik":           "robotik_de",
+	"/wiki/Robotique":         "robotique_fr",
+	"/wiki/Category:Robotics": "category_robotics",
+	"/wiki/Category:Robots":   "category_robots",
+	"/w/index.php?title=Category:Robotics&pagefrom=Robot": "category_robotics_2",
+	"/2024/03/choosing-a-robot-arm":                       "robot_arms_blog",
+}
+
+// newFixtureServer serves the testdata pages at the same paths Wikipedia
+// uses for them.
+func newFixtureServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.URL.Path
+		if r.URL.RawQuery != "" {
+			key += "?" + r.URL.RawQuery
+		}
+		name, ok := fixturePages[key]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+		http.ServeFile(w, r, filepath.Join("testdata", name+".html"))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// TestScrapeEndToEnd runs the collector against a local server and checks
+// that every record matches what ParseArticle produces for the fixture.
+func TestScrapeEndToEnd(t *testing.T) {
+	srv := newFixtureServer(t)
+	outDir := t.TempDir()
+	urls := []string{srv.URL + "/wiki/Robotics", srv.URL + "/wiki/Chatbot"}
+
+	var buf bytes.Buffer
+	scrape(context.Background(), urls, &buf, scrapeOptions{outDir: outDir})
+
+	records := map[string][]byte{}
+	scanner := bufio.NewScanner(&buf)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		var data WebsiteData
+		if err := json.Unmarshal(scanner.Bytes(), &data); err != nil {
+			t.Fatalf("invalid JSON line: %v", err)
+		}
+		records[data.URL] = append([]byte(nil), scanner.Bytes()...)
+	}
+	if len(records) != len(urls) {
+		t.Fatalf("got %d records, want %d", len(records), len(urls))
+	}
+
+	for _, u := range urls {
+		name := map[string]string{urls[0]: "robotics", urls[1]: "chatbot"}[u]
+		want, err := json.Marshal(parseFixture(t, name, u))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(records[u], want) {
+			t.Errorf("record for %s differs from ParseArticle output", u)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(outDir, "tables", "Robotics_table1.csv")); err != nil {
+		t.Errorf("table file not written: %v", err)
+	}
+}
+
+// TestScrapeOrdered scrapes the fixtures several times from a server that
+// answers after a random delay, so pages finish in a different order each
+// time, and checks that ordered outputs are nevertheless identical.
+func TestScrapeOrdered(t *testing.T) {
+	fixtures := newFixtureServer(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(time.Duration(rand.Intn(300)) * time.Millisecond)
+		http.Redirect(w, r, fixtures.URL+r.URL.Path, http.StatusTemporaryRedirect)
+	}))
+	defer srv.Close()
+
+	urls := []string{srv.URL + "/wiki/Robotique", srv.URL + "/wiki/Robotics", srv.URL + "/wiki/Robotik", srv.URL + "/wiki/Chatbot"}
+	sorted := append([]string(nil), urls...)
+	sort.Strings(sorted)
+
+	for order, want := range map[string][]string{orderInput: urls, orderURL: sorted} {
+		t.Run(order, func(t *testing.T) {
+			var first []byte
+			for run := 0; run < 3; run++ {
+				var buf bytes.Buffer
+				records := scrape(context.Background(), urls, &buf, scrapeOptions{outDir: t.TempDir(), order: order})
+				var got []string
+				for _, data := range records {
+					got = append(got, data.URL)
+				}
+				if !reflect.DeepEqual(got, want) {
+					t.Fatalf("run %d: records in order %v, want %v", run, got, want)
+				}
+				if run == 0 {
+					first = buf.Bytes()
+				} else if !bytes.Equal(buf.Bytes(), first) {
+					t.Errorf("run %d: output differs from the first run", run)
+				}
+			}
+			if lines := bytes.Count(first, []byte("\n")); lines != len(urls) {
+				t.Errorf("output has %d lines, want %d", lines, len(urls))
+			}
+		})
+	}
+}
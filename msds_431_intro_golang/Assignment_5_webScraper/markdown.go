@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// markdownEscaper escapes the characters that Markdown would otherwise
+// read as emphasis, links, code or HTML.
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "`", "\\`", "*", `\*`, "_", `\_`, "[", `\[`, "]", `\]`, "<", `\<`, ">", `\>`, "|", `\|`,
+)
+
+// markdownText escapes text for use in a Markdown paragraph, including
+// a leading "#", "+", "-" or "1." that would start a heading or a list.
+func markdownText(text string) string {
+	text = markdownEscaper.Replace(strings.Join(strings.Fields(text), " "))
+	if strings.HasPrefix(text, "#") || strings.HasPrefix(text, "+") || strings.HasPrefix(text, "-") {
+		return `\` + text
+	}
+	if i := strings.IndexFunc(text, func(r rune) bool { return r < '0' || r > '9' }); i > 0 && (text[i] == '.' || text[i] == ')') {
+		return text[:i] + `\` + text[i:]
+	}
+	return text
+}
+
+// writeMarkdown renders an article as Markdown: the title, a link to the
+// source page, and every section with its paragraphs, lists, quotes and
+// table captions. The lead has no heading of its own; the other sections
+// keep their level, so an h3 section becomes "###".
+func writeMarkdown(w io.Writer, data WebsiteData) error {
+	fmt.Fprintf(w, "# %s\n\nSource: <%s>\n", markdownText(data.Title), data.URL)
+	for _, sec := range sectionTexts(data) {
+		if sec.Level > 1 {
+			fmt.Fprintf(w, "\n%s %s\n", strings.Repeat("#", min(sec.Level, 6)), markdownText(sec.Title()))
+		}
+		for _, p := range sec.Paragraphs {
+			fmt.Fprintf(w, "\n%s\n", markdownText(p))
+		}
+		for _, b := range sec.Blocks {
+			io.WriteString(w, "\n")
+			switch b.Type {
+			case "blockquote":
+				fmt.Fprintf(w, "> %s\n", markdownText(b.Text))
+			default:
+				for i, item := range b.Items {
+					if b.Ordered {
+						fmt.Fprintf(w, "%d. %s\n", i+1, markdownText(item))
+					} else {
+						fmt.Fprintf(w, "- %s\n", markdownText(item))
+					}
+				}
+			}
+		}
+		for _, t := range sec.Tables {
+			caption := "Table"
+			if t.Caption != "" {
+				caption += ": " + markdownText(t.Caption)
+			}
+			fmt.Fprintf(w, "\n*%s* ([CSV](%s))\n", caption, filepath.ToSlash(t.CSV))
+		}
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// writeMarkdownFiles writes one Markdown file per article into dir, named
+// like the article's table files, and an index.md linking to all of them.
+// It returns the number of articles written.
+func writeMarkdownFiles(dir string, records []WebsiteData) (int, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return 0, fmt.Errorf("failed to create directory %s: %w", dir, err)
+	}
+
+	var index strings.Builder
+	index.WriteString("# Scraped articles\n\n")
+	used := map[string]bool{"index": true}
+	for _, data := range records {
+		name := articleFileName(data.URL)
+		for n := 2; used[name]; n++ {
+			name = fmt.Sprintf("%s_%d", articleFileName(data.URL), n)
+		}
+		used[name] = true
+
+		file, err := os.Create(filepath.Join(dir, name+".md"))
+		if err != nil {
+			return 0, fmt.Errorf("failed to create Markdown file: %w", err)
+		}
+		err = writeMarkdown(file, data)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed to write %s.md: %w", name, err)
+		}
+		fmt.Fprintf(&index, "- [%s](%s.md)\n", markdownText(data.Title), name)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "index.md"), []byte(index.String()), 0o644); err != nil {
+		return 0, fmt.Errorf("failed to write index.md: %w", err)
+	}
+	return len(records), nil
+}
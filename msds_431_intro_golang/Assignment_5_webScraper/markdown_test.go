@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// parseBlog parses the blog fixture with its site profile, which gives
+// an article with every kind of content: nested sections, a list, a
+// quote and a table.
+func parseBlog(t *testing.T) WebsiteData {
+	t.Helper()
+	profiles, err := loadSiteProfiles(filepath.Join("testdata", "profiles"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Open(filepath.Join("testdata", "robot_arms_blog.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	data, err := ParseArticle(file, blogURL, profiles...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestMarkdownText(t *testing.T) {
+	tests := []struct {
+		text, expected string
+	}{
+		{"Plain text.", "Plain text."},
+		{"  spread\n over lines ", "spread over lines"},
+		{"a*b_c [1] <br> x|y `code`", "a\\*b\\_c \\[1\\] \\<br\\> x\\|y \\`code\\`"},
+		{"# not a heading", "\\# not a heading"},
+		{"- not a list", "\\- not a list"},
+		{"1961. A year", "1961\\. A year"},
+		{"1961 was a year", "1961 was a year"},
+	}
+	for _, tt := range tests {
+		if got := markdownText(tt.text); got != tt.expected {
+			t.Errorf("markdownText(%q) = %q, want %q", tt.text, got, tt.expected)
+		}
+	}
+}
+
+func TestWriteMarkdown(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeMarkdown(&buf, parseBlog(t)); err != nil {
+		t.Fatal(err)
+	}
+	expected := `# Choosing a robot arm
+
+Source: <https://makernotes.example/2024/03/choosing-a-robot-arm>
+
+Desktop robot arms have become cheap enough for hobby projects. This post compares servo and stepper designs.
+
+## Servo arms
+
+Servo arms are light and simple to wire.
+
+- Low cost
+- Limited precision
+
+### Calibration
+
+Each joint needs its zero position set by hand.
+
+## Stepper arms
+
+Stepper arms hold their position without power.
+
+> Precision is worth the extra weight.
+
+*Table: Typical specs* ([CSV](tables/choosing-a-robot-arm_table1.csv))
+
+`
+	if buf.String() != expected {
+		t.Errorf("writeMarkdown() =\n%s\nwant\n%s", buf.String(), expected)
+	}
+}
+
+func TestWriteMarkdownFiles(t *testing.T) {
+	robotics := parseFixture(t, "robotics", fixtures["robotics"])
+	robotik := parseFixture(t, "robotik_de", fixtures["robotik_de"])
+	dir := filepath.Join(t.TempDir(), "markdown")
+	count, err := writeMarkdownFiles(dir, []WebsiteData{robotics, robotik, robotics})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 3 {
+		t.Errorf("wrote %d articles, want 3", count)
+	}
+
+	index, err := os.ReadFile(filepath.Join(dir, "index.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"- [Robotics](Robotics.md)", "- [Robotik](de_Robotik.md)", "- [Robotics](Robotics_2.md)"} {
+		if !strings.Contains(string(index), line+"\n") {
+			t.Errorf("index.md lacks %q:\n%s", line, index)
+		}
+	}
+	page, err := os.ReadFile(filepath.Join(dir, "Robotics_2.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(page), "# Robotics\n\nSource: <"+robotics.URL+">\n") {
+		t.Errorf("Robotics_2.md starts with %q", string(page)[:60])
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// reportFileName is where every run writes its metrics.
+const reportFileName = "wikipedia_data.report.json"
+
+// pageMetrics describes the fetch and parse of one URL. Status is 0 when
+// no response was received.
+type pageMetrics struct {
+	URL         string  `json:"url"`
+	Status      int     `json:"status"`
+	Bytes       int     `json:"bytes"`
+	FetchMillis float64 `json:"fetch_ms"`
+	ParseMillis float64 `json:"parse_ms"`
+	Sections    int     `json:"sections"`
+	Paragraphs  int     `json:"paragraphs"`
+	Error       string  `json:"error,omitempty"`
+}
+
+// setCounts fills in the section and paragraph counts of a record.
+func (m *pageMetrics) setCounts(data WebsiteData) {
+	m.Sections = len(data.Sections)
+	m.Paragraphs = 0
+	for _, sec := range data.Sections {
+		m.Paragraphs += len(sec.Paragraphs)
+	}
+}
+
+func millisSince(t time.Time) float64 {
+	return float64(time.Since(t).Microseconds()) / 1000
+}
+
+// runReport summarizes a run for the report file.
+type runReport struct {
+	Started         time.Time     `json:"started"`
+	Finished        time.Time     `json:"finished"`
+	DurationSeconds float64       `json:"duration_seconds"`
+	Pages           int           `json:"pages"`
+	Succeeded       int           `json:"succeeded"`
+	Failed          int           `json:"failed"`
+	Bytes           int64         `json:"bytes"`
+	Sections        int           `json:"sections"`
+	Paragraphs      int           `json:"paragraphs"`
+	PageMetrics     []pageMetrics `json:"page_metrics"`
+}
+
+// crawlMetrics collects the metrics of every page of a run. A nil
+// *crawlMetrics ignores everything recorded on it.
+type crawlMetrics struct {
+	mu      sync.Mutex
+	started time.Time
+	pages   []pageMetrics
+}
+
+func newCrawlMetrics() *crawlMetrics {
+	return &crawlMetrics{started: time.Now()}
+}
+
+func (c *crawlMetrics) record(m pageMetrics) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	c.pages = append(c.pages, m)
+	c.mu.Unlock()
+}
+
+// snapshot returns a copy of the pages recorded so far.
+func (c *crawlMetrics) snapshot() []pageMetrics {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]pageMetrics(nil), c.pages...)
+}
+
+func (c *crawlMetrics) report() runReport {
+	r := runReport{Started: c.started, Finished: time.Now(), PageMetrics: c.snapshot()}
+	r.DurationSeconds = r.Finished.Sub(r.Started).Seconds()
+	r.Pages = len(r.PageMetrics)
+	for _, m := range r.PageMetrics {
+		if m.Error == "" {
+			r.Succeeded++
+		} else {
+			r.Failed++
+		}
+		r.Bytes += int64(m.Bytes)
+		r.Sections += m.Sections
+		r.Paragraphs += m.Paragraphs
+	}
+	if r.PageMetrics == nil {
+		r.PageMetrics = []pageMetrics{}
+	}
+	return r
+}
+
+// writeReport writes the run report to fileName as indented JSON.
+func (c *crawlMetrics) writeReport(fileName string) error {
+	raw, err := json.MarshalIndent(c.report(), "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(fileName, raw); err != nil {
+		return fmt.Errorf("failed to write %s: %w", fileName, err)
+	}
+	return nil
+}
+
+// Histogram buckets, in seconds, for fetch and parse durations.
+var durationBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// ServeHTTP writes the metrics in the Prometheus text exposition format.
+func (c *crawlMetrics) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	c.writePrometheus(w)
+}
+
+func (c *crawlMetrics) writePrometheus(w io.Writer) {
+	pages := c.snapshot()
+
+	statuses := map[int]int{}
+	var failed, bytes, sections, paragraphs int
+	var fetch, parse []float64
+	for _, m := range pages {
+		statuses[m.Status]++
+		if m.Error != "" {
+			failed++
+		}
+		bytes += m.Bytes
+		sections += m.Sections
+		paragraphs += m.Paragraphs
+		fetch = append(fetch, m.FetchMillis/1000)
+		if m.Error == "" {
+			parse = append(parse, m.ParseMillis/1000)
+		}
+	}
+
+	fmt.Fprintln(w, "# HELP scraper_pages_total Pages fetched, by HTTP status (0 when there was no response).")
+	fmt.Fprintln(w, "# TYPE scraper_pages_total counter")
+	var codes []int
+	for code := range statuses {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	for _, code := range codes {
+		fmt.Fprintf(w, "scraper_pages_total{status=\"%d\"} %d\n", code, statuses[code])
+	}
+	counter(w, "scraper_page_errors_total", "Pages that could not be fetched or parsed.", failed)
+	counter(w, "scraper_fetched_bytes_total", "Bytes of page content received.", bytes)
+	counter(w, "scraper_sections_total", "Sections extracted from all pages.", sections)
+	counter(w, "scraper_paragraphs_total", "Paragraphs extracted from all pages.", paragraphs)
+	histogram(w, "scraper_fetch_duration_seconds", "Time to fetch a page.", fetch)
+	histogram(w, "scraper_parse_duration_seconds", "Time to parse a fetched page.", parse)
+	fmt.Fprintln(w, "# HELP scraper_run_duration_seconds Time since the run started.")
+	fmt.Fprintln(w, "# TYPE scraper_run_duration_seconds gauge")
+	fmt.Fprintf(w, "scraper_run_duration_seconds %g\n", time.Since(c.started).Seconds())
+}
+
+func counter(w io.Writer, name, help string, value int) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n%s %d\n", name, help, name, name, value)
+}
+
+func histogram(w io.Writer, name, help string, values []float64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", name, help, name)
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	for _, le := range durationBuckets {
+		n := 0
+		for _, v := range values {
+			if v <= le {
+				n++
+			}
+		}
+		fmt.Fprintf(w, "%s_bucket{le=\"%g\"} %d\n", name, le, n)
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", name, len(values))
+	fmt.Fprintf(w, "%s_sum %g\n", name, sum)
+	fmt.Fprintf(w, "%s_count %d\n", name, len(values))
+}
+
+// serveMetrics serves c at /metrics on addr until the returned function is
+// called.
+func serveMetrics(addr string, c *crawlMetrics) (func(), error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serve metrics on %s: %w", addr, err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", c)
+	srv := &http.Server{Handler: mux}
+	go srv.Serve(ln)
+	return func() { srv.Close() }, nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestScrapeMetrics checks that every page of a run, including a failed
+// one, is recorded with its status, size and counts.
+func TestScrapeMetrics(t *testing.T) {
+	srv := newFixtureServer(t)
+	urls := []string{srv.URL + "/wiki/Robotics", srv.URL + "/wiki/Chatbot", srv.URL + "/wiki/No_such_article"}
+	metrics := newCrawlMetrics()
+	records := scrape(context.Background(), urls, io.Discard, scrapeOptions{outDir: t.TempDir(), metrics: metrics})
+
+	pages := map[string]pageMetrics{}
+	for _, m := range metrics.snapshot() {
+		pages[m.URL] = m
+	}
+	if len(pages) != len(urls) {
+		t.Fatalf("got metrics for %d pages, want %d", len(pages), len(urls))
+	}
+	for _, data := range records {
+		m := pages[data.URL]
+		var want pageMetrics
+		want.setCounts(data)
+		if m.Status != 200 || m.Bytes == 0 || m.Error != "" {
+			t.Errorf("%s: status %d, %d bytes, error %q", data.URL, m.Status, m.Bytes, m.Error)
+		}
+		if m.Sections != want.Sections || m.Paragraphs != want.Paragraphs {
+			t.Errorf("%s: %d sections and %d paragraphs, want %d and %d", data.URL, m.Sections, m.Paragraphs, want.Sections, want.Paragraphs)
+		}
+	}
+	if m := pages[urls[2]]; m.Status != 404 || m.Error == "" {
+		t.Errorf("missing page: status %d, error %q, want 404 and an error", m.Status, m.Error)
+	}
+
+	file := filepath.Join(t.TempDir(), "report.json")
+	if err := metrics.writeReport(file); err != nil {
+		t.Fatal(err)
+	}
+	raw, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report runReport
+	if err := json.Unmarshal(raw, &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Pages != 3 || report.Succeeded != 2 || report.Failed != 1 || len(report.PageMetrics) != 3 {
+		t.Errorf("report has %d pages, %d succeeded, %d failed, want 3, 2 and 1", report.Pages, report.Succeeded, report.Failed)
+	}
+	if want := pages[urls[0]].Sections + pages[urls[1]].Sections; report.Sections != want {
+		t.Errorf("report has %d sections, want %d", report.Sections, want)
+	}
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	metrics := newCrawlMetrics()
+	metrics.record(pageMetrics{URL: "a", Status: 200, Bytes: 100, FetchMillis: 80, ParseMillis: 5, Sections: 3, Paragraphs: 7})
+	metrics.record(pageMetrics{URL: "b", Status: 200, Bytes: 50, FetchMillis: 300, ParseMillis: 20, Sections: 1, Paragraphs: 2})
+	metrics.record(pageMetrics{URL: "c", Status: 404, FetchMillis: 10, Error: "Not Found"})
+
+	rec := httptest.NewRecorder()
+	metrics.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	body := rec.Body.String()
+	for _, line := range []string{
+		`scraper_pages_total{status="200"} 2`,
+		`scraper_pages_total{status="404"} 1`,
+		`scraper_page_errors_total 1`,
+		`scraper_fetched_bytes_total 150`,
+		`scraper_sections_total 4`,
+		`scraper_paragraphs_total 9`,
+		`scraper_fetch_duration_seconds_bucket{le="0.05"} 1`,
+		`scraper_fetch_duration_seconds_bucket{le="0.1"} 2`,
+		`scraper_fetch_duration_seconds_bucket{le="0.5"} 3`,
+		`scraper_fetch_duration_seconds_bucket{le="+Inf"} 3`,
+		`scraper_fetch_duration_seconds_count 3`,
+		`scraper_parse_duration_seconds_count 2`,
+		`# TYPE scraper_run_duration_seconds gauge`,
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("metrics lack %q", line)
+		}
+	}
+}
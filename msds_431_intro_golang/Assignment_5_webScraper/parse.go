@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// ParseArticle extracts the title and sections of an article from its
+// HTML. pageURL is recorded in the result and used to resolve relative
+// links; no network access is done. The first of profiles whose hosts
+// include the host of pageURL says where the parts of the article are;
+// without one, the page is read as a Wikipedia article.
+func ParseArticle(r io.Reader, pageURL string, profiles ...*SiteProfile) (WebsiteData, error) {
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return WebsiteData{}, fmt.Errorf("invalid URL %s: %w", pageURL, err)
+	}
+	doc, err := goquery.NewDocumentFromReader(r)
+	if err != nil {
+		return WebsiteData{}, fmt.Errorf("failed to parse HTML from %s: %w", pageURL, err)
+	}
+
+	profile := profileFor(base.Hostname(), profiles)
+	data := parseContent(profile.content(doc), base, pageURL, profile.title(doc), profile)
+	if data.Language == "" {
+		data.Language = doc.Find("html").AttrOr("lang", "")
+	}
+	data.WikidataID = wikidataID(doc.Find("#t-wikibase a").AttrOr("href", ""))
+	data.LangLinks = parseLangLinks(doc.Selection)
+	return data, nil
+}
+
+// parseContent builds the record of an article from its content element
+// (the profile's content root, or the parser output returned by the API).
+// base is pageURL already parsed.
+func parseContent(content *goquery.Selection, base *url.URL, pageURL, title string, profile *SiteProfile) WebsiteData {
+	builder := newSectionBuilder(base, profile)
+	builder.refs = parseReferences(content)
+	content.Find("*").Each(func(_ int, s *goquery.Selection) {
+		builder.add(s)
+	})
+
+	return WebsiteData{
+		SchemaVersion: SchemaVersion,
+		URL:           pageURL,
+		Title:         title,
+		Language:      content.Find(".mw-parser-output").First().AttrOr("lang", ""),
+		OutLinks:      outLinks(content, base, profile),
+		Sections:      builder.flatSections(),
+		SectionTree:   builder.tree(),
+	}
+}
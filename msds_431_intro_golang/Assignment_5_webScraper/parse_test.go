@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// fixtures maps the saved HTML pages in testdata to the URL they were
+// saved from.
+var fixtures = map[string]string{
+	"robotics":     "https://en.wikipedia.org/wiki/Robotics",
+	"chatbot":      "https://en.wikipedia.org/wiki/Chatbot",
+	"robotik_de":   "https://de.wikipedia.org/wiki/Robotik",
+	"robotique_fr": "https://fr.wikipedia.org/wiki/Robotique",
+}
+
+func parseFixture(t *testing.T, name, pageURL string) WebsiteData {
+	t.Helper()
+	file, err := os.Open(filepath.Join("testdata", name+".html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	data, err := ParseArticle(file, pageURL)
+	if err != nil {
+		t.Fatalf("ParseArticle(%s) error: %v", name, err)
+	}
+	return data
+}
+
+// TestParseArticleGolden compares the parsed fixtures with the expected
+// JSON in testdata/*.golden.json. Run with -update after an intended
+// change to the output.
+func TestParseArticleGolden(t *testing.T) {
+	for name, pageURL := range fixtures {
+		t.Run(name, func(t *testing.T) {
+			data := parseFixture(t, name, pageURL)
+			got, err := json.MarshalIndent(data, "", "  ")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, '\n')
+
+			golden := filepath.Join("testdata", name+".golden.json")
+			if *update {
+				if err := os.WriteFile(golden, got, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("output for %s differs from %s; rerun with -update if the change is intended", name, golden)
+			}
+		})
+	}
+}
+
+func TestParseArticleSections(t *testing.T) {
+	data := parseFixture(t, "robotics", fixtures["robotics"])
+
+	if data.Title != "Robotics" {
+		t.Errorf("Title = %q, want %q", data.Title, "Robotics")
+	}
+
+	var titles []string
+	for _, sec := range data.SectionTree {
+		titles = append(titles, sec.Title)
+	}
+	wantTitles := []string{"main_summary", "Robotics aspects", "History", "References"}
+	if len(titles) != len(wantTitles) {
+		t.Fatalf("top level sections = %v, want %v", titles, wantTitles)
+	}
+	for i := range wantTitles {
+		if titles[i] != wantTitles[i] {
+			t.Errorf("section %d = %q, want %q", i, titles[i], wantTitles[i])
+		}
+	}
+
+	aspects := data.SectionTree[1]
+	if len(aspects.Children) != 1 || aspects.Children[0].Title != "Power source" {
+		t.Fatalf("Robotics aspects children = %+v, want [Power source]", aspects.Children)
+	}
+	power := aspects.Children[0]
+	if power.Level != 3 || power.Anchor != "Power_source" {
+		t.Errorf("Power source level/anchor = %d/%q", power.Level, power.Anchor)
+	}
+	if len(power.Children) != 1 || power.Children[0].Level != 4 {
+		t.Errorf("Power source children = %+v, want one level 4 section", power.Children)
+	}
+	if len(aspects.Blocks) != 1 || len(aspects.Blocks[0].Items) != 3 {
+		t.Errorf("Robotics aspects blocks = %+v, want one list of 3 items", aspects.Blocks)
+	}
+
+	// The ordered sections list every heading once, in document order.
+	var flat []string
+	for _, sec := range data.Sections {
+		flat = append(flat, fmt.Sprintf("%d:%s", sec.Level, sec.Title))
+	}
+	wantFlat := []string{"1:main_summary", "2:Robotics aspects", "3:Power source", "4:Pneumatic artificial muscles", "2:History", "2:References"}
+	if !reflect.DeepEqual(flat, wantFlat) {
+		t.Errorf("sections = %v, want %v", flat, wantFlat)
+	}
+	if data.SchemaVersion != SchemaVersion {
+		t.Errorf("SchemaVersion = %d, want %d", data.SchemaVersion, SchemaVersion)
+	}
+}
+
+func TestParseArticleCitations(t *testing.T) {
+	data := parseFixture(t, "robotics", fixtures["robotics"])
+
+	lead := data.SectionTree[0].Paragraphs
+	if len(lead) != 2 {
+		t.Fatalf("lead paragraphs = %d, want 2", len(lead))
+	}
+	if want := "Robotics is the interdisciplinary study and practice of the design, construction, operation, and use of robots."; lead[0].CleanText != want {
+		t.Errorf("CleanText = %q, want %q", lead[0].CleanText, want)
+	}
+	if len(lead[0].Citations) != 1 {
+		t.Fatalf("citations = %+v, want 1", lead[0].Citations)
+	}
+	cite := lead[0].Citations[0]
+	if cite.Marker != "[1]" || cite.Publisher != "Greenwood Publishing Group" || cite.Date != "2007" {
+		t.Errorf("citation = %+v", cite)
+	}
+	if len(lead[0].Links) != 1 || lead[0].Links[0].URL != "https://en.wikipedia.org/wiki/Robot" || lead[0].Links[0].Type != "internal" {
+		t.Errorf("links = %+v", lead[0].Links)
+	}
+
+	history := data.SectionTree[2].Paragraphs[0]
+	last := history.Links[len(history.Links)-1]
+	if last.Type != "external" || last.URL != "https://www.ifr.org/" {
+		t.Errorf("external link = %+v", last)
+	}
+}
+
+func TestParseTable(t *testing.T) {
+	data := parseFixture(t, "robotics", fixtures["robotics"])
+
+	tables := data.SectionTree[1].Children[0].Tables
+	if len(tables) != 1 {
+		t.Fatalf("tables = %d, want 1", len(tables))
+	}
+	ref := tables[0]
+	if ref.CSV != "tables/Robotics_table1.csv" || ref.Caption != "Common power sources" {
+		t.Errorf("table ref = %+v", ref)
+	}
+	wantHeader := [][]string{{"Source", "Typical use", "Typical use"}, {"Source", "Indoor", "Outdoor"}}
+	wantRows := [][]string{{"Battery", "Yes", "Yes"}, {"Battery", "Most common", "Most common"}, {"Solar", "No", "Yes"}}
+	if got, _ := json.Marshal(ref.table.Header); string(got) != mustJSON(t, wantHeader) {
+		t.Errorf("header = %s", got)
+	}
+	if got, _ := json.Marshal(ref.table.Rows); string(got) != mustJSON(t, wantRows) {
+		t.Errorf("rows = %s", got)
+	}
+}
+
+func mustJSON(t *testing.T, v interface{}) string {
+	t.Helper()
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	_ "embed" // The built-in Wikipedia profile is embedded
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/andybalholm/cascadia"
+)
+
+// SiteProfile tells the extractor where the parts of an article are in
+// the pages of one site. Every selector is a CSS selector group. Elements
+// of the content root are visited in document order, and each one is
+// recorded as the first kind whose rule it matches.
+type SiteProfile struct {
+	Name    string   `json:"name"`
+	Hosts   []string `json:"hosts"`   // the profile applies to these hosts and their subdomains
+	Title   []string `json:"title"`   // tried in order; the first with text is the title
+	Content string   `json:"content"` // root of the article body; empty means <body>
+
+	Headings     elementRule `json:"headings"`
+	HeadingText  string      `json:"heading_text,omitempty"`  // element inside a heading that holds its title
+	HeadingStrip string      `json:"heading_strip,omitempty"` // removed from a heading before its title is read
+	Paragraphs   elementRule `json:"paragraphs"`
+	Lists        elementRule `json:"lists"`
+	Tables       elementRule `json:"tables"`
+	Blockquotes  elementRule `json:"blockquotes"`
+	Exclude      string      `json:"exclude,omitempty"` // nothing inside these elements is extracted
+
+	headingText, headingStrip, exclude goquery.Matcher
+}
+
+// elementRule selects one kind of content element. An element matching
+// Select is skipped when it is inside an element matching Skip. A rule
+// without Select extracts nothing.
+type elementRule struct {
+	Select string `json:"select"`
+	Skip   string `json:"skip,omitempty"`
+
+	sel, skip goquery.Matcher
+}
+
+// matches reports whether s is an element of the rule's kind.
+func (r *elementRule) matches(s *goquery.Selection) bool {
+	if r.sel == nil || !s.IsMatcher(r.sel) {
+		return false
+	}
+	return r.skip == nil || s.ParentsMatcher(r.skip).Length() == 0
+}
+
+//go:embed profiles/wikipedia.json
+var wikipediaProfileJSON []byte
+
+// wikipediaProfile is used for Wikipedia and for every host that no
+// other profile claims.
+var wikipediaProfile = mustDecodeProfile(wikipediaProfileJSON)
+
+func mustDecodeProfile(raw []byte) *SiteProfile {
+	var p SiteProfile
+	if err := json.Unmarshal(raw, &p); err != nil {
+		panic(err)
+	}
+	if err := p.compile(); err != nil {
+		panic(err)
+	}
+	return &p
+}
+
+// compile checks the selectors of the profile and prepares them for
+// matching.
+func (p *SiteProfile) compile() error {
+	matcher := func(field, sel string) (goquery.Matcher, error) {
+		if strings.TrimSpace(sel) == "" {
+			return nil, nil
+		}
+		m, err := cascadia.Compile(sel)
+		if err != nil {
+			return nil, fmt.Errorf("profile %s: invalid %s selector %q: %w", p.Name, field, sel, err)
+		}
+		return m, nil
+	}
+
+	for _, sel := range append([]string{p.Content}, p.Title...) {
+		if _, err := matcher("title or content", sel); err != nil {
+			return err
+		}
+	}
+	var err error
+	if p.headingText, err = matcher("heading_text", p.HeadingText); err != nil {
+		return err
+	}
+	if p.headingStrip, err = matcher("heading_strip", p.HeadingStrip); err != nil {
+		return err
+	}
+	if p.exclude, err = matcher("exclude", p.Exclude); err != nil {
+		return err
+	}
+	for name, rule := range map[string]*elementRule{
+		"headings":    &p.Headings,
+		"paragraphs":  &p.Paragraphs,
+		"lists":       &p.Lists,
+		"tables":      &p.Tables,
+		"blockquotes": &p.Blockquotes,
+	} {
+		if rule.sel, err = matcher(name, rule.Select); err != nil {
+			return err
+		}
+		if rule.skip, err = matcher(name+" skip", rule.Skip); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// title returns the text of the first title selector that has any.
+func (p *SiteProfile) title(doc *goquery.Document) string {
+	for _, sel := range p.Title {
+		if title := strings.TrimSpace(doc.Find(sel).First().Text()); title != "" {
+			return title
+		}
+	}
+	return ""
+}
+
+// content returns the root of the article body.
+func (p *SiteProfile) content(doc *goquery.Document) *goquery.Selection {
+	if p.Content == "" {
+		return doc.Find("body")
+	}
+	return doc.Find(p.Content)
+}
+
+// profileFor returns the first of profiles that applies to host, or the
+// built-in Wikipedia profile.
+func profileFor(host string, profiles []*SiteProfile) *SiteProfile {
+	for _, p := range profiles {
+		if matchesDomain(host, p.Hosts) {
+			return p
+		}
+	}
+	return wikipediaProfile
+}
+
+// loadSiteProfiles reads the profiles in path, which is a JSON file or a
+// directory of them. Each file holds one profile or an array of them.
+// Files in a directory are read in name order.
+func loadSiteProfiles(path string) ([]*SiteProfile, error) {
+	files := []string{path}
+	if info, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("failed to read site profiles: %w", err)
+	} else if info.IsDir() {
+		if files, err = filepath.Glob(filepath.Join(path, "*.json")); err != nil {
+			return nil, err
+		}
+		sort.Strings(files)
+	}
+
+	var profiles []*SiteProfile
+	for _, file := range files {
+		raw, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read site profiles: %w", err)
+		}
+		var batch []*SiteProfile
+		if trimmed := strings.TrimSpace(string(raw)); strings.HasPrefix(trimmed, "[") {
+			err = json.Unmarshal(raw, &batch)
+		} else {
+			var p SiteProfile
+			err = json.Unmarshal(raw, &p)
+			batch = []*SiteProfile{&p}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid site profile in %s: %w", file, err)
+		}
+		for _, p := range batch {
+			if len(p.Hosts) == 0 {
+				return nil, fmt.Errorf("site profile %q in %s has no hosts", p.Name, file)
+			}
+			for i, h := range p.Hosts {
+				p.Hosts[i] = strings.ToLower(strings.TrimSpace(h))
+			}
+			if err := p.compile(); err != nil {
+				return nil, fmt.Errorf("%s: %w", file, err)
+			}
+		}
+		profiles = append(profiles, batch...)
+	}
+	return profiles, nil
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const blogURL = "https://makernotes.example/2024/03/choosing-a-robot-arm"
+
+// TestWikipediaProfileMatchesGolden parses every fixture with the
+// Wikipedia profile loaded from profiles/wikipedia.json, as a user's copy
+// of it would be, and checks that the output is the golden output.
+func TestWikipediaProfileMatchesGolden(t *testing.T) {
+	profiles, err := loadSiteProfiles(filepath.Join("profiles", "wikipedia.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(profiles) != 1 || !reflect.DeepEqual(profiles[0].Hosts, wikipediaProfile.Hosts) {
+		t.Fatalf("loaded %d profiles, want the Wikipedia profile", len(profiles))
+	}
+
+	for name, pageURL := range fixtures {
+		t.Run(name, func(t *testing.T) {
+			file, err := os.Open(filepath.Join("testdata", name+".html"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer file.Close()
+			data, err := ParseArticle(file, pageURL, profiles...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := json.MarshalIndent(data, "", "  ")
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := os.ReadFile(filepath.Join("testdata", name+".golden.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(append(got, '\n'), want) {
+				t.Errorf("profile output for %s differs from the golden file", name)
+			}
+		})
+	}
+}
+
+func TestProfileFor(t *testing.T) {
+	blog := &SiteProfile{Name: "blog", Hosts: []string{"makernotes.example"}}
+	profiles := []*SiteProfile{blog}
+	tests := []struct {
+		host string
+		want *SiteProfile
+	}{
+		{"makernotes.example", blog},
+		{"www.makernotes.example", blog},
+		{"notmakernotes.example", wikipediaProfile},
+		{"en.wikipedia.org", wikipediaProfile},
+		{"127.0.0.1", wikipediaProfile},
+	}
+	for _, tt := range tests {
+		if got := profileFor(tt.host, profiles); got != tt.want {
+			t.Errorf("profileFor(%q) = %s, want %s", tt.host, got.Name, tt.want.Name)
+		}
+	}
+}
+
+func TestBlogProfile(t *testing.T) {
+	profiles, err := loadSiteProfiles(filepath.Join("testdata", "profiles"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Open(filepath.Join("testdata", "robot_arms_blog.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	data, err := ParseArticle(file, blogURL, profiles...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if data.Title != "Choosing a robot arm" || data.Language != "en" {
+		t.Errorf("title = %q, language = %q", data.Title, data.Language)
+	}
+	want := []SectionRecord{
+		{Title: "main_summary", Level: 1, Paragraphs: []string{"Desktop robot arms have become cheap enough for hobby projects. This post compares servo and stepper designs."}},
+		{Title: "Servo arms", Level: 2, Paragraphs: []string{"Servo arms are light and simple to wire."}},
+		{Title: "Calibration", Level: 3, Paragraphs: []string{"Each joint needs its zero position set by hand."}},
+		{Title: "Stepper arms", Level: 2, Paragraphs: []string{"Stepper arms hold their position without power."}},
+	}
+	if !reflect.DeepEqual(data.Sections, want) {
+		t.Errorf("sections =\n%s\nwant\n%s", mustJSON(t, data.Sections), mustJSON(t, want))
+	}
+
+	servo, stepper := data.SectionTree[1], data.SectionTree[2]
+	if servo.Anchor != "servo-arms" || len(servo.Children) != 1 {
+		t.Errorf("servo section: anchor %q, %d children", servo.Anchor, len(servo.Children))
+	}
+	if len(servo.Blocks) != 1 || !reflect.DeepEqual(servo.Blocks[0].Items, []string{"Low cost", "Limited precision"}) {
+		t.Errorf("servo blocks = %+v", servo.Blocks)
+	}
+	if len(stepper.Blocks) != 1 || stepper.Blocks[0].Type != "blockquote" {
+		t.Errorf("stepper blocks = %+v", stepper.Blocks)
+	}
+	if len(stepper.Tables) != 1 || stepper.Tables[0].Caption != "Typical specs" {
+		t.Errorf("stepper tables = %+v", stepper.Tables)
+	}
+	links := data.SectionTree[0].Paragraphs[0].Links
+	if len(links) != 2 || links[0].URL != "https://makernotes.example/tags/servo" || links[0].Type != "external" {
+		t.Errorf("lead links = %+v", links)
+	}
+}
+
+// TestScrapeWithProfile checks that scrape picks the profile by the host
+// of each URL.
+func TestScrapeWithProfile(t *testing.T) {
+	profiles, err := loadSiteProfiles(filepath.Join("testdata", "profiles", "maker_notes.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := newFixtureServer(t)
+	target, _ := url.Parse(srv.URL)
+	opts := scrapeOptions{outDir: t.TempDir(), transport: hostRewriter{target}, profiles: profiles}
+
+	urls := []string{blogURL, "https://en.wikipedia.org/wiki/Robotics"}
+	records := scrape(context.Background(), urls, &bytes.Buffer{}, opts)
+	titles := map[string]string{}
+	for _, data := range records {
+		titles[data.URL] = data.Title
+	}
+	want := map[string]string{blogURL: "Choosing a robot arm", urls[1]: "Robotics"}
+	if !reflect.DeepEqual(titles, want) {
+		t.Errorf("titles = %v, want %v", titles, want)
+	}
+}
+
+func TestLoadSiteProfilesErrors(t *testing.T) {
+	tests := []struct {
+		name, content, want string
+	}{
+		{"no hosts", `{"name": "blog", "content": "main"}`, "has no hosts"},
+		{"bad selector", `{"name": "blog", "hosts": ["a.example"], "paragraphs": {"select": "p[", "skip": ""}}`, "invalid paragraphs selector"},
+		{"bad JSON", `{"name": `, "invalid site profile"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "profile.json")
+			if err := os.WriteFile(file, []byte(tt.content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			_, err := loadSiteProfiles(file)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error = %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+
+	file := filepath.Join(t.TempDir(), "profiles.json")
+	os.WriteFile(file, []byte(`[{"name": "a", "hosts": ["A.example "]}, {"name": "b", "hosts": ["b.example"]}]`), 0o644)
+	profiles, err := loadSiteProfiles(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(profiles) != 2 || profiles[0].Hosts[0] != "a.example" {
+		t.Errorf("profiles = %+v", profiles)
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Paragraph is a single <p> of an article with its citation markers
+// resolved and its links extracted.
+type Paragraph struct {
+	Text      string     `json:"text"`
+	CleanText string     `json:"clean_text"`
+	Citations []Citation `json:"citations,omitempty"`
+	Links     []Link     `json:"links,omitempty"`
+}
+
+// Reference is an entry of the article's reference list. Fields that the
+// source does not provide are left empty.
+type Reference struct {
+	ID        string `json:"id"`
+	Text      string `json:"text"`
+	Title     string `json:"title,omitempty"`
+	URL       string `json:"url,omitempty"`
+	Publisher string `json:"publisher,omitempty"`
+	Date      string `json:"date,omitempty"`
+}
+
+// Citation is a "[n]" marker found in a paragraph together with the
+// reference it points to.
+type Citation struct {
+	Marker string `json:"marker"`
+	Reference
+}
+
+// Link is a hyperlink found in a paragraph. Type is "internal" for links
+// to other Wikipedia articles and "external" for everything else.
+type Link struct {
+	Text string `json:"text"`
+	URL  string `json:"url"`
+	Type string `json:"type"`
+}
+
+// OutLink is a page of the article's own wiki that the article links to
+// anywhere in its content, with the number of links to it.
+type OutLink struct {
+	URL   string `json:"url"`
+	Count int    `json:"count"`
+}
+
+// Inline elements that are citation markers rather than article text.
+const citationMarkers = "sup.reference, sup.noprint"
+
+// parseReferences indexes the article's reference list by the id of each
+// entry, which is what the citation markers link to.
+func parseReferences(content *goquery.Selection) map[string]Reference {
+	refs := make(map[string]Reference)
+	content.Find("ol.references > li[id]").Each(func(_ int, li *goquery.Selection) {
+		id, _ := li.Attr("id")
+		body := li.Find(".reference-text").First()
+		if body.Length() == 0 {
+			body = li
+		}
+		ref := Reference{ID: id, Text: strings.TrimSpace(body.Text())}
+
+		// Citation templates embed a COinS span whose title attribute holds
+		// the source metadata as a query string.
+		if coins, ok := body.Find("span.Z3988").Attr("title"); ok {
+			if meta, err := url.ParseQuery(coins); err == nil {
+				ref.Title = firstNonEmpty(meta.Get("rft.atitle"), meta.Get("rft.btitle"), meta.Get("rft.title"))
+				ref.Publisher = firstNonEmpty(meta.Get("rft.pub"), meta.Get("rft.jtitle"))
+				ref.Date = meta.Get("rft.date")
+				if id := meta.Get("rft_id"); strings.HasPrefix(id, "http") {
+					ref.URL = id
+				}
+			}
+		}
+
+		if ext := body.Find("a.external").First(); ext.Length() > 0 {
+			if ref.URL == "" {
+				ref.URL = ext.AttrOr("href", "")
+			}
+			if ref.Title == "" {
+				ref.Title = strings.Trim(strings.TrimSpace(ext.Text()), `"`)
+			}
+		}
+		refs[id] = ref
+	})
+	return refs
+}
+
+// newParagraph builds a Paragraph from a <p> element. Links are resolved
+// against base, and citation markers are looked up in refs.
+func newParagraph(p *goquery.Selection, base *url.URL, refs map[string]Reference) Paragraph {
+	para := Paragraph{Text: p.Text()}
+
+	p.Find("sup.reference").Each(func(_ int, sup *goquery.Selection) {
+		marker := strings.TrimSpace(sup.Text())
+		href := sup.Find("a").AttrOr("href", "")
+		id := href[strings.IndexByte(href, '#')+1:]
+		cite := Citation{Marker: marker, Reference: Reference{ID: id}}
+		if ref, ok := refs[id]; ok {
+			cite.Reference = ref
+		}
+		para.Citations = append(para.Citations, cite)
+	})
+
+	p.Find("a[href]").Each(func(_ int, a *goquery.Selection) {
+		if a.ParentsFiltered(citationMarkers).Length() > 0 {
+			return
+		}
+		href, _ := a.Attr("href")
+		if strings.HasPrefix(href, "#") {
+			return
+		}
+		link := Link{Text: strings.TrimSpace(a.Text()), URL: href, Type: "external"}
+		if u, err := url.Parse(href); err == nil {
+			if base != nil {
+				u = base.ResolveReference(u)
+			}
+			link.URL = u.String()
+			if base != nil && u.Host == base.Host && strings.HasPrefix(u.Path, "/wiki/") {
+				link.Type = "internal"
+			}
+		}
+		para.Links = append(para.Links, link)
+	})
+
+	clean := p.Clone()
+	clean.Find(citationMarkers).Remove()
+	para.CleanText = strings.TrimSpace(clean.Text())
+	return para
+}
+
+// namespacedTitle matches the title of a page outside the article
+// namespace, such as "File:Robot.jpg", "Help:Contents" or
+// "User_talk:Example": one word, optionally followed by "_talk", and a
+// colon right before the title. A colon followed by a space, as in
+// "Star_Wars:_Episode_IV", is part of an article title.
+var namespacedTitle = regexp.MustCompile(`^\p{L}+(_talk)?:[^_]`)
+
+// isArticlePath reports whether path is a /wiki/ path of an article
+// rather than of a file, category, help, talk or other namespace page.
+func isArticlePath(path string) bool {
+	title, ok := strings.CutPrefix(path, "/wiki/")
+	return ok && title != "" && !namespacedTitle.MatchString(title)
+}
+
+// outLinks returns the articles on the host of base that the links in
+// content point to, in the order of their first link. Links in lists,
+// tables, infoboxes and "See also" sections count as well as those in
+// paragraphs. Citation markers, links within the page, links of the page
+// to itself, links to namespace pages and the profile's excluded
+// elements do not. Fragments are dropped, so a link to a section counts
+// for its page.
+func outLinks(content *goquery.Selection, base *url.URL, profile *SiteProfile) []OutLink {
+	var links []OutLink
+	index := map[string]int{}
+	content.Find("a[href]").Each(func(_ int, a *goquery.Selection) {
+		if profile.exclude != nil && a.ClosestMatcher(profile.exclude).Length() > 0 {
+			return
+		}
+		if a.ParentsFiltered(citationMarkers).Length() > 0 {
+			return
+		}
+		href, _ := a.Attr("href")
+		if strings.HasPrefix(href, "#") {
+			return
+		}
+		u, err := url.Parse(href)
+		if err != nil {
+			return
+		}
+		u = base.ResolveReference(u)
+		if u.Host != base.Host || !isArticlePath(u.Path) || u.RawQuery != "" || u.Path == base.Path {
+			return
+		}
+		u.Fragment = ""
+		target := u.String()
+		if i, ok := index[target]; ok {
+			links[i].Count++
+			return
+		}
+		index[target] = len(links)
+		links = append(links, OutLink{URL: target, Count: 1})
+	})
+	return links
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const referenceList = `<div class="mw-references-wrap"><ol class="references">
+<li id="cite_note-asimov-1"><span class="mw-cite-backlink">^ <a href="#cite_ref-asimov_1-0"><sup>a</sup></a> <a href="#cite_ref-asimov_1-1"><sup>b</sup></a></span>
+<span class="reference-text"><cite>Asimov, Isaac. <a class="external text" href="https://example.org/runaround">"Runaround"</a>. Street &amp; Smith.</cite><span class="Z3988" title="rft.atitle=Runaround&amp;rft.jtitle=Astounding+Science+Fiction&amp;rft.date=1942-03&amp;rft_id=https%3A%2F%2Fexample.org%2Fastounding"></span></span></li>
+<li id="cite_note-2"><span class="mw-cite-backlink"><a href="#cite_ref-2">^</a></span>
+<span class="reference-text"><a class="external text" href="https://example.org/rur">"R.U.R."</a> play by Karel Čapek.</span></li>
+<li id="cite_note-3"><span class="mw-cite-backlink"><a href="#cite_ref-3">^</a></span>
+<span class="reference-text">A note without a source.</span></li>
+</ol></div>`
+
+func parseHTML(t *testing.T, html string) *goquery.Document {
+	t.Helper()
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(html))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+func TestParseReferences(t *testing.T) {
+	refs := parseReferences(parseHTML(t, referenceList).Selection)
+	want := map[string]Reference{
+		// COinS metadata wins over the external link.
+		"cite_note-asimov-1": {
+			ID:        "cite_note-asimov-1",
+			Text:      `Asimov, Isaac. "Runaround". Street & Smith.`,
+			Title:     "Runaround",
+			URL:       "https://example.org/astounding",
+			Publisher: "Astounding Science Fiction",
+			Date:      "1942-03",
+		},
+		"cite_note-2": {
+			ID:    "cite_note-2",
+			Text:  `"R.U.R." play by Karel Čapek.`,
+			Title: "R.U.R.",
+			URL:   "https://example.org/rur",
+		},
+		"cite_note-3": {ID: "cite_note-3", Text: "A note without a source."},
+	}
+	if !reflect.DeepEqual(refs, want) {
+		t.Errorf("references = %+v\nwant %+v", refs, want)
+	}
+}
+
+func TestNewParagraph(t *testing.T) {
+	base, _ := url.Parse("https://en.wikipedia.org/wiki/Robot")
+	doc := parseHTML(t, `<p>A <a href="/wiki/Machine" title="Machine">machine</a> from
+<a href="https://example.org/rur">a play</a><sup id="cite_ref-2" class="reference"><a href="#cite_note-2">[2]</a></sup>,
+see <a href="#History">below</a> and <a href="//de.wikipedia.org/wiki/Roboter">Roboter</a>.<sup id="cite_ref-asimov_1-0" class="reference"><a href="#cite_note-asimov-1">[1]</a></sup><sup class="reference"><a href="#cite_note-9">[9]</a></sup></p>`+referenceList)
+	refs := parseReferences(doc.Selection)
+	para := newParagraph(doc.Find("p").First(), base, refs)
+
+	if want := "A machine from\na play,\nsee below and Roboter."; para.CleanText != want {
+		t.Errorf("clean text = %q, want %q", para.CleanText, want)
+	}
+	if !strings.Contains(para.Text, "[2]") {
+		t.Errorf("text %q lost its citation markers", para.Text)
+	}
+
+	wantCitations := []Citation{
+		{Marker: "[2]", Reference: refs["cite_note-2"]},
+		{Marker: "[1]", Reference: refs["cite_note-asimov-1"]},
+		// A marker without a list entry keeps its id.
+		{Marker: "[9]", Reference: Reference{ID: "cite_note-9"}},
+	}
+	if !reflect.DeepEqual(para.Citations, wantCitations) {
+		t.Errorf("citations = %+v\nwant %+v", para.Citations, wantCitations)
+	}
+
+	// Citation markers and links within the page are not links.
+	wantLinks := []Link{
+		{Text: "machine", URL: "https://en.wikipedia.org/wiki/Machine", Type: "internal"},
+		{Text: "a play", URL: "https://example.org/rur", Type: "external"},
+		{Text: "Roboter", URL: "https://de.wikipedia.org/wiki/Roboter", Type: "external"},
+	}
+	if !reflect.DeepEqual(para.Links, wantLinks) {
+		t.Errorf("links = %+v\nwant %+v", para.Links, wantLinks)
+	}
+}
+
+func TestOutLinks(t *testing.T) {
+	base, _ := url.Parse("https://en.wikipedia.org/wiki/Robot")
+	doc := parseHTML(t, `<div id="content"><p><a href="/wiki/Machine">machine</a>
+<a href="/wiki/File:Robot_arm.jpg">arm</a> <a href="/wiki/Help:IPA/English">help</a>
+<a href="/wiki/Category:Robots">robots</a> <a href="/wiki/Special:BookSources/0-13-0">ISBN</a>
+<a href="/wiki/Talk:Robot">talk</a> <a href="/wiki/Wikipedia_talk:Robotics">project</a>
+<a href="/wiki/Star_Wars:_Episode_IV_%E2%80%93_A_New_Hope">Star Wars</a>
+<a href="/wiki/Machine#History">history of machines</a> <a href="/wiki/Robot">itself</a>
+<a href="/w/index.php?title=Robot&action=edit">edit</a></p></div>`)
+	links := outLinks(doc.Find("#content"), base, wikipediaProfile)
+	want := []OutLink{
+		{URL: "https://en.wikipedia.org/wiki/Machine", Count: 2},
+		{URL: "https://en.wikipedia.org/wiki/Star_Wars:_Episode_IV_%E2%80%93_A_New_Hope", Count: 1},
+	}
+	if !reflect.DeepEqual(links, want) {
+		t.Errorf("out links = %+v\nwant %+v", links, want)
+	}
+}
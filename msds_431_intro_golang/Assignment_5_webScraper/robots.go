@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/temoto/robotstxt"
+)
+
+// Reasons a URL is skipped without being fetched.
+var (
+	errDomainNotAllowed = errors.New("domain is not in the allowed list")
+	errDomainDenied     = errors.New("domain is in the disallowed list")
+	errRobotsDisallowed = errors.New("disallowed by robots.txt")
+)
+
+// defaultUserAgent identifies the crawler when --user-agent is not set.
+const defaultUserAgent = "go-web-crawler/1.0"
+
+// crawlPolicy decides which URLs may be fetched and how fast. It is
+// shared by every collector of a run, so robots.txt is read once per
+// host and the crawl delay holds across goroutines.
+type crawlPolicy struct {
+	userAgent    string
+	ignoreRobots bool
+	crawlDelay   time.Duration // a negative value means "use robots.txt"
+	allowed      []string      // when not empty, only these domains are crawled
+	denied       []string
+	client       *http.Client
+
+	mu     sync.Mutex
+	robots map[string]*hostRobots
+	next   map[string]time.Time // earliest time of the next request per host
+}
+
+// hostRobots is the robots.txt of one host. once makes the first caller
+// fetch it while later callers for the same host wait, without holding
+// crawlPolicy.mu over the network.
+type hostRobots struct {
+	once sync.Once
+	data *robotstxt.RobotsData
+	err  error
+}
+
+func newCrawlPolicy(userAgent string, transport http.RoundTripper) *crawlPolicy {
+	return &crawlPolicy{
+		userAgent:  userAgent,
+		crawlDelay: -1,
+		client:     &http.Client{Transport: transport, Timeout: 30 * time.Second},
+		robots:     map[string]*hostRobots{},
+		next:       map[string]time.Time{},
+	}
+}
+
+// userAgentString combines the crawler name with contact details, e.g.
+// "go-web-crawler/1.0 (+mailto:team@example.com)".
+func userAgentString(name, contact string) string {
+	if name == "" {
+		name = defaultUserAgent
+	}
+	if contact == "" {
+		return name
+	}
+	return fmt.Sprintf("%s (+%s)", name, contact)
+}
+
+// splitList parses a comma separated flag value.
+func splitList(value string) []string {
+	var out []string
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.ToLower(strings.TrimSpace(v)); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// matchesDomain reports whether host is one of domains or a subdomain of
+// one of them.
+func matchesDomain(host string, domains []string) bool {
+	host = strings.ToLower(host)
+	for _, d := range domains {
+		if host == d || strings.HasSuffix(host, "."+d) {
+			return true
+		}
+	}
+	return false
+}
+
+// check returns nil when the article page at pageURL may be fetched, or
+// the reason it must be skipped.
+func (p *crawlPolicy) check(pageURL string) error {
+	if p == nil {
+		return nil
+	}
+	u, err := url.Parse(pageURL)
+	if err != nil {
+		return err
+	}
+	if err := p.checkDomain(u); err != nil {
+		return err
+	}
+	if p.ignoreRobots {
+		return nil
+	}
+	group, err := p.robotsGroup(u)
+	if err != nil {
+		return err
+	}
+	if !group.Test(u.RequestURI()) {
+		return fmt.Errorf("%w for %s", errRobotsDisallowed, p.userAgent)
+	}
+	return nil
+}
+
+// checkURL is check without robots.txt, for requests to the MediaWiki API
+// and to index.php, such as the next page of a category. Wikipedia's
+// robots.txt disallows /w/ for every crawler, which is meant for crawlers
+// following links, not for clients of the API. Those requests still keep
+// to the crawl delay.
+func (p *crawlPolicy) checkURL(reqURL string) error {
+	if p == nil {
+		return nil
+	}
+	u, err := url.Parse(reqURL)
+	if err != nil {
+		return err
+	}
+	return p.checkDomain(u)
+}
+
+// checkDomain applies the allowed and denied domain lists to u.
+func (p *crawlPolicy) checkDomain(u *url.URL) error {
+	host := u.Hostname()
+	if len(p.allowed) > 0 && !matchesDomain(host, p.allowed) {
+		return fmt.Errorf("%w (%s)", errDomainNotAllowed, host)
+	}
+	if matchesDomain(host, p.denied) {
+		return fmt.Errorf("%w (%s)", errDomainDenied, host)
+	}
+	return nil
+}
+
+// robotsGroup returns the robots.txt rules that apply to this crawler on
+// the host of u, fetching robots.txt the first time the host is seen. A
+// host whose robots.txt could not be fetched is not tried again.
+func (p *crawlPolicy) robotsGroup(u *url.URL) (*robotstxt.Group, error) {
+	p.mu.Lock()
+	host, ok := p.robots[u.Host]
+	if !ok {
+		host = &hostRobots{}
+		p.robots[u.Host] = host
+	}
+	p.mu.Unlock()
+
+	host.once.Do(func() {
+		host.data, host.err = p.fetchRobots(u.Scheme + "://" + u.Host + "/robots.txt")
+	})
+	if host.err != nil {
+		return nil, host.err
+	}
+	return host.data.FindGroup(p.userAgent), nil
+}
+
+// fetchRobots downloads and parses the robots.txt at robotsURL.
+func (p *crawlPolicy) fetchRobots(robotsURL string) (*robotstxt.RobotsData, error) {
+	req, err := http.NewRequest(http.MethodGet, robotsURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", p.userAgent)
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %w", robotsURL, err)
+	}
+	robots, err := robotstxt.FromResponse(resp)
+	resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", robotsURL, err)
+	}
+	return robots, nil
+}
+
+// delay returns the time to leave between two requests to the host of u:
+// the --crawl-delay override if set, otherwise the robots.txt Crawl-delay.
+func (p *crawlPolicy) delay(u *url.URL) time.Duration {
+	if p.crawlDelay >= 0 {
+		return p.crawlDelay
+	}
+	if p.ignoreRobots {
+		return 0
+	}
+	group, err := p.robotsGroup(u)
+	if err != nil {
+		return 0
+	}
+	return group.CrawlDelay
+}
+
+// wait blocks until a request to pageURL is allowed by the crawl delay.
+// Each caller reserves the next free slot for the host, so concurrent
+// goroutines are spaced out as well. It returns early with the context's
+// error when ctx is cancelled.
+func (p *crawlPolicy) wait(ctx context.Context, pageURL string) error {
+	if p == nil {
+		return ctx.Err()
+	}
+	u, err := url.Parse(pageURL)
+	if err != nil {
+		return ctx.Err()
+	}
+	d := p.delay(u)
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	p.mu.Lock()
+	now := time.Now()
+	slot := p.next[u.Host]
+	if slot.Before(now) {
+		slot = now
+	}
+	p.next[u.Host] = slot.Add(d)
+	p.mu.Unlock()
+
+	timer := time.NewTimer(time.Until(slot))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
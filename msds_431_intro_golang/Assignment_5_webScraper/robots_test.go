@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newRobotsServer(t *testing.T) (*httptest.Server, *string) {
+	t.Helper()
+	var gotAgent string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			gotAgent = r.Header.Get("User-Agent")
+			io.WriteString(w, "User-agent: *\nDisallow: /w/\n\nUser-agent: go-web-crawler\nDisallow: /private/\nCrawl-delay: 2\n")
+			return
+		}
+		io.WriteString(w, "<p>ok</p>")
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &gotAgent
+}
+
+func TestCrawlPolicyCheck(t *testing.T) {
+	srv, gotAgent := newRobotsServer(t)
+	ua := userAgentString("go-web-crawler/1.0", "mailto:team@example.com")
+	policy := newCrawlPolicy(ua, nil)
+
+	tests := []struct {
+		name    string
+		url     string
+		wantErr error
+	}{
+		{"Allowed page", srv.URL + "/wiki/Robotics", nil},
+		{"Disallowed for this agent", srv.URL + "/private/page", errRobotsDisallowed},
+		{"Rules for * do not apply to a named agent", srv.URL + "/w/index.php", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := policy.check(tt.url)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("check(%s) = %v, want %v", tt.url, err, tt.wantErr)
+			}
+		})
+	}
+	if *gotAgent != "go-web-crawler/1.0 (+mailto:team@example.com)" {
+		t.Errorf("robots.txt fetched with User-Agent %q", *gotAgent)
+	}
+
+	policy.ignoreRobots = true
+	if err := policy.check(srv.URL + "/private/page"); err != nil {
+		t.Errorf("check with ignoreRobots = %v", err)
+	}
+}
+
+func TestCrawlPolicyDomains(t *testing.T) {
+	policy := newCrawlPolicy(defaultUserAgent, nil)
+	policy.ignoreRobots = true
+	policy.allowed = splitList("wikipedia.org, wikimedia.org")
+	policy.denied = splitList("de.wikipedia.org")
+
+	tests := []struct {
+		url     string
+		wantErr error
+	}{
+		{"https://en.wikipedia.org/wiki/Robot", nil},
+		{"https://de.wikipedia.org/wiki/Roboter", errDomainDenied},
+		{"https://example.com/robots", errDomainNotAllowed},
+		{"https://notwikipedia.org/wiki/Robot", errDomainNotAllowed},
+	}
+	for _, tt := range tests {
+		if err := policy.check(tt.url); !errors.Is(err, tt.wantErr) {
+			t.Errorf("check(%s) = %v, want %v", tt.url, err, tt.wantErr)
+		}
+	}
+}
+
+func TestCrawlPolicyDelay(t *testing.T) {
+	srv, _ := newRobotsServer(t)
+	policy := newCrawlPolicy(defaultUserAgent, nil)
+
+	u := srv.URL + "/wiki/Robotics"
+	if err := policy.check(u); err != nil {
+		t.Fatal(err)
+	}
+	parsed, _ := http.NewRequest(http.MethodGet, u, nil)
+	if got := policy.delay(parsed.URL); got != 2*time.Second {
+		t.Errorf("delay from robots.txt = %v, want 2s", got)
+	}
+
+	// The override wins over robots.txt and spaces out concurrent callers.
+	policy.crawlDelay = 30 * time.Millisecond
+	start := time.Now()
+	done := make(chan bool)
+	for i := 0; i < 3; i++ {
+		go func() {
+			policy.wait(context.Background(), u)
+			done <- true
+		}()
+	}
+	for i := 0; i < 3; i++ {
+		<-done
+	}
+	if elapsed := time.Since(start); elapsed < 60*time.Millisecond {
+		t.Errorf("three waits took %v, want at least 60ms", elapsed)
+	}
+
+	// A cancelled context ends the wait for a slot far in the future.
+	policy.crawlDelay = time.Hour
+	policy.wait(context.Background(), u)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := policy.wait(ctx, u); !errors.Is(err, context.Canceled) {
+		t.Errorf("wait with a cancelled context = %v, want context.Canceled", err)
+	}
+}
+
+// wikipediaRobots answers robots.txt requests with the rules of
+// Wikipedia, which disallow /w/ for every crawler, and passes all other
+// requests to next.
+type wikipediaRobots struct {
+	next http.RoundTripper
+}
+
+func (w wikipediaRobots) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Path != "/robots.txt" {
+		return w.next.RoundTrip(req)
+	}
+	rec := httptest.NewRecorder()
+	io.WriteString(rec, "User-agent: *\nDisallow: /w/\n")
+	return rec.Result(), nil
+}
+
+// TestCrawlPolicyAllowsAPI checks that the robots.txt rules for /w/ keep
+// the crawler off article URLs there, but not off the API or the next
+// pages of a category.
+func TestCrawlPolicyAllowsAPI(t *testing.T) {
+	transport := wikipediaRobots{http.DefaultTransport}
+	policy := newCrawlPolicy(defaultUserAgent, transport)
+
+	apiSrv := newAPIServer(t)
+	if err := policy.check(apiSrv.URL + "/w/index.php?title=Robotics"); !errors.Is(err, errRobotsDisallowed) {
+		t.Errorf("check of a page under /w/ = %v, want %v", err, errRobotsDisallowed)
+	}
+	var buf bytes.Buffer
+	opts := scrapeOptions{outDir: t.TempDir(), source: "api", transport: transport, policy: policy}
+	urls := []string{apiSrv.URL + "/wiki/Robotics", apiSrv.URL + "/wiki/Chatbots"}
+	if records := scrape(context.Background(), urls, &buf, opts); len(records) != 2 {
+		t.Errorf("API scrape returned %d records, want 2", len(records))
+	}
+
+	srv := newFixtureServer(t)
+	opts = scrapeOptions{transport: transport, policy: policy}
+	members, err := crawlCategory(context.Background(), categoryURL(srv.URL, "Category:Robotics"), 0, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(members) != 3 {
+		t.Errorf("category members = %v, want the members of both pages", members)
+	}
+}
+
+// TestCrawlPolicySlowRobots checks that a host whose robots.txt is slow
+// to load does not hold up the checks for other hosts.
+func TestCrawlPolicySlowRobots(t *testing.T) {
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		io.WriteString(w, "User-agent: *\nAllow: /\n")
+	}))
+	defer slow.Close()
+	defer close(release)
+	fast, _ := newRobotsServer(t)
+
+	policy := newCrawlPolicy(defaultUserAgent, nil)
+	go policy.check(slow.URL + "/wiki/Robotics")
+	time.Sleep(20 * time.Millisecond)
+
+	done := make(chan error, 1)
+	go func() { done <- policy.check(fast.URL + "/wiki/Robotics") }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("check = %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("check for one host waited for the robots.txt of another")
+	}
+}
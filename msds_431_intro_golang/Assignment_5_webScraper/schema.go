@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// legacyRecord is the layout written before schema_version existed:
+// "sections" held an object whose own "sections" field was a list of
+// single-key maps from section title to {"paragraph": [...]}.
+type legacyRecord struct {
+	URL      string `json:"url"`
+	Title    string `json:"title"`
+	Sections struct {
+		Sections []map[string]struct {
+			Paragraphs []string `json:"paragraph"`
+		} `json:"sections"`
+	} `json:"sections"`
+	SectionTree []*Section `json:"section_tree"`
+}
+
+// upgrade converts a legacy record to the current schema. The old output
+// only had the lead and the h2 sections, so every section other than
+// main_summary becomes level 2. Records written with a section_tree
+// folded the subsections into their h2 section; their sections are
+// listed from the tree instead, as the scraper lists them now.
+func (old legacyRecord) upgrade() WebsiteData {
+	data := WebsiteData{
+		SchemaVersion: SchemaVersion,
+		URL:           old.URL,
+		Title:         old.Title,
+		Sections:      []SectionRecord{},
+		SectionTree:   old.SectionTree,
+	}
+	if len(old.SectionTree) > 0 {
+		data.Sections = flattenSections(old.SectionTree)
+		return data
+	}
+	for _, m := range old.Sections.Sections {
+		for title, ps := range m {
+			level := 2
+			if title == "main_summary" {
+				level = 1
+			}
+			paragraphs := ps.Paragraphs
+			if paragraphs == nil {
+				paragraphs = []string{}
+			}
+			data.Sections = append(data.Sections, SectionRecord{Title: title, Level: level, Paragraphs: paragraphs})
+		}
+	}
+	return data
+}
+
+// UnmarshalJSON also accepts a paragraph written as a plain string, as
+// the section tree held them before citations and links were extracted.
+func (p *Paragraph) UnmarshalJSON(raw []byte) error {
+	if len(raw) > 0 && raw[0] == '"' {
+		var text string
+		if err := json.Unmarshal(raw, &text); err != nil {
+			return err
+		}
+		*p = Paragraph{Text: text}
+		return nil
+	}
+	// paragraph has no methods, so decoding into it does not recurse.
+	type paragraph Paragraph
+	return json.Unmarshal(raw, (*paragraph)(p))
+}
+
+// decodeRecord decodes one record of any schema version into the current
+// layout.
+func decodeRecord(raw []byte) (WebsiteData, error) {
+	var probe struct {
+		SchemaVersion int `json:"schema_version"`
+	}
+	if err := json.Unmarshal(raw, &probe); err != nil {
+		return WebsiteData{}, err
+	}
+	if probe.SchemaVersion > SchemaVersion {
+		return WebsiteData{}, fmt.Errorf("schema version %d is newer than this program supports (%d)", probe.SchemaVersion, SchemaVersion)
+	}
+	if probe.SchemaVersion == 0 {
+		var old legacyRecord
+		if err := json.Unmarshal(raw, &old); err != nil {
+			return WebsiteData{}, err
+		}
+		return old.upgrade(), nil
+	}
+	var data WebsiteData
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return WebsiteData{}, err
+	}
+	return data, nil
+}
+
+// decodeRecords reads every record from r. It accepts JSON lines written
+// by the scraper as well as the combined JSON files of the older
+// programs, which map page URLs to records, optionally under a
+// "websites" key. Records of such maps are returned sorted by URL.
+func decodeRecords(r io.Reader) ([]WebsiteData, error) {
+	dec := json.NewDecoder(bufio.NewReader(r))
+	var records []WebsiteData
+	for n := 1; ; n++ {
+		var obj map[string]json.RawMessage
+		if err := dec.Decode(&obj); err != nil {
+			if errors.Is(err, io.EOF) {
+				return records, nil
+			}
+			return nil, fmt.Errorf("invalid JSON value %d: %w", n, err)
+		}
+
+		if websites, ok := obj["websites"]; ok {
+			obj = nil
+			if err := json.Unmarshal(websites, &obj); err != nil {
+				return nil, fmt.Errorf("invalid websites object: %w", err)
+			}
+		} else if isRecord(obj) {
+			raw, _ := json.Marshal(obj)
+			data, err := decodeRecord(raw)
+			if err != nil {
+				return nil, fmt.Errorf("invalid record %d: %w", n, err)
+			}
+			records = append(records, data)
+			continue
+		}
+
+		urls := make([]string, 0, len(obj))
+		for u := range obj {
+			urls = append(urls, u)
+		}
+		sort.Strings(urls)
+		for _, u := range urls {
+			data, err := decodeRecord(obj[u])
+			if err != nil {
+				return nil, fmt.Errorf("invalid record for %s: %w", u, err)
+			}
+			if data.URL == "" {
+				data.URL = u
+			}
+			records = append(records, data)
+		}
+	}
+}
+
+// isRecord reports whether a decoded object is a single record rather
+// than a map of records keyed by URL.
+func isRecord(obj map[string]json.RawMessage) bool {
+	for _, key := range []string{"schema_version", "url", "title", "sections"} {
+		if _, ok := obj[key]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// runMigrate implements the "migrate" command, which rewrites older
+// scrape outputs as JSON lines in the current schema.
+func runMigrate(args []string) int {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	input := fs.String("input", "wikipedia_data.json", "scrape output to convert (JSON lines or a combined JSON file)")
+	output := fs.String("output", "wikipedia_data.migrated.jsonl", "JSON lines file to write")
+	fs.Parse(args)
+
+	in, err := os.Open(*input)
+	if err != nil {
+		fmt.Printf("Error opening file %s: %v\n", *input, err)
+		return 1
+	}
+	records, err := decodeRecords(in)
+	in.Close()
+	if err != nil {
+		fmt.Printf("Error: %s: %v\n", *input, err)
+		return 1
+	}
+
+	if err := writeJSONLFile(*output, records); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Migrated %d records from %s to %s (schema version %d)\n", len(records), *input, *output, SchemaVersion)
+	return 0
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const legacyLine = `{"url":"https://en.wikipedia.org/wiki/Robot","title":"Robot","sections":{"sections":[` +
+	`{"main_summary":{"paragraph":["A robot is a machine."]}},` +
+	`{"History":{"paragraph":["Early robots.","Later robots."]}},` +
+	`{"History":{"paragraph":["A second section with the same title."]}}]}}`
+
+func TestDecodeRecords(t *testing.T) {
+	wantLegacy := []SectionRecord{
+		{Title: "main_summary", Level: 1, Paragraphs: []string{"A robot is a machine."}},
+		{Title: "History", Level: 2, Paragraphs: []string{"Early robots.", "Later robots."}},
+		{Title: "History", Level: 2, Paragraphs: []string{"A second section with the same title."}},
+	}
+
+	tests := []struct {
+		name     string
+		input    string
+		wantURLs []string
+	}{
+		{"legacy jsonl", legacyLine + "\n" + strings.Replace(legacyLine, "/Robot", "/Android", 1) + "\n",
+			[]string{"https://en.wikipedia.org/wiki/Robot", "https://en.wikipedia.org/wiki/Android"}},
+		{"websites map", `{"websites": {"https://en.wikipedia.org/wiki/Robot": {"title": "Robot", "sections": {"sections": [` +
+			`{"main_summary":{"paragraph":["A robot is a machine."]}},{"History":{"paragraph":["Early robots.","Later robots."]}},` +
+			`{"History":{"paragraph":["A second section with the same title."]}}]}}}}`,
+			[]string{"https://en.wikipedia.org/wiki/Robot"}},
+		{"url map", `{"https://en.wikipedia.org/wiki/Robot": ` + legacyLine + `}`,
+			[]string{"https://en.wikipedia.org/wiki/Robot"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records, err := decodeRecords(strings.NewReader(tt.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var urls []string
+			for _, r := range records {
+				urls = append(urls, r.URL)
+				if r.SchemaVersion != SchemaVersion {
+					t.Errorf("%s: SchemaVersion = %d, want %d", r.URL, r.SchemaVersion, SchemaVersion)
+				}
+				if !reflect.DeepEqual(r.Sections, wantLegacy) {
+					t.Errorf("%s: sections = %+v, want %+v", r.URL, r.Sections, wantLegacy)
+				}
+			}
+			if !reflect.DeepEqual(urls, tt.wantURLs) {
+				t.Errorf("urls = %v, want %v", urls, tt.wantURLs)
+			}
+		})
+	}
+}
+
+func TestDecodeRecordVersions(t *testing.T) {
+	data, err := decodeRecord([]byte(`{"schema_version":2,"url":"u","title":"T","sections":[{"title":"main_summary","level":1,"paragraphs":["p"]}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data.Sections) != 1 || data.Sections[0].Paragraphs[0] != "p" {
+		t.Errorf("sections = %+v", data.Sections)
+	}
+
+	if _, err := decodeRecord([]byte(`{"schema_version":99,"url":"u"}`)); err == nil {
+		t.Error("decodeRecord accepted a newer schema version")
+	}
+}
+
+func TestMigrateRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	in := filepath.Join(dir, "old.jsonl")
+	out := filepath.Join(dir, "new.jsonl")
+	if err := os.WriteFile(in, []byte(legacyLine+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if code := runMigrate([]string{"-input", in, "-output", out}); code != 0 {
+		t.Fatalf("migrate exit code = %d", code)
+	}
+
+	raw, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(raw), `{"schema_version":2,`) {
+		t.Errorf("migrated line = %s", raw)
+	}
+	records, err := readRecords(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || len(records[0].Sections) != 3 {
+		t.Fatalf("records = %+v", records)
+	}
+	paths := sectionTexts(records[0])
+	if got := paths[1].Path; !reflect.DeepEqual(got, []string{"History"}) {
+		t.Errorf("path of second section = %v, want [History]", got)
+	}
+}
+
+// TestMigrateIntermediateLayout migrates records written with both the
+// legacy sections object and a section_tree, once with plain string
+// paragraphs and once with paragraph objects, and verifies the result.
+func TestMigrateIntermediateLayout(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "new.jsonl")
+	in := filepath.Join("testdata", "intermediate_layout.jsonl")
+	if code := runMigrate([]string{"-input", in, "-output", out}); code != 0 {
+		t.Fatalf("migrate exit code = %d", code)
+	}
+
+	robot, chatbot := "https://en.wikipedia.org/wiki/Robot", "https://en.wikipedia.org/wiki/Chatbot"
+	result, err := verifyOutput(out, []string{robot, chatbot})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.failed() || len(result.Problems) > 0 {
+		t.Errorf("verify found problems in the migrated records: %+v", result)
+	}
+
+	want := []SectionRecord{
+		{Title: "main_summary", Level: 1, Paragraphs: []string{"A robot is a machine."}},
+		{Title: "History", Level: 2, Paragraphs: []string{"Early robots."}},
+		{Title: "Automata", Level: 3, Paragraphs: []string{"Automata of the 18th century."}},
+		{Title: "See also", Level: 2, Paragraphs: []string{}},
+	}
+	if len(result.Records) != 2 || !reflect.DeepEqual(result.Records[0].Sections, want) {
+		t.Fatalf("sections of %s = %+v, want %+v", robot, result.Records[0].Sections, want)
+	}
+	if got := sectionTexts(result.Records[1])[0].Paragraphs; !reflect.DeepEqual(got, []string{"A chatbot is a program."}) {
+		t.Errorf("lead of %s = %q, want the citation-free text", chatbot, got)
+	}
+}
+
+// TestSchemaMatchesOutput keeps schema/website_data.schema.json in step
+// with the records the parser writes.
+func TestSchemaMatchesOutput(t *testing.T) {
+	raw, err := os.ReadFile(filepath.Join("schema", "website_data.schema.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var schema struct {
+		Required   []string `json:"required"`
+		Properties map[string]struct {
+			Const *int `json:"const"`
+		} `json:"properties"`
+		Defs map[string]struct {
+			Properties map[string]json.RawMessage `json:"properties"`
+		} `json:"$defs"`
+	}
+	if err := json.Unmarshal(raw, &schema); err != nil {
+		t.Fatalf("invalid schema: %v", err)
+	}
+	if v := schema.Properties["schema_version"].Const; v == nil || *v != SchemaVersion {
+		t.Errorf("schema_version const = %v, want %d", v, SchemaVersion)
+	}
+
+	// A one-sentence summary gives the record and its lead a summary field.
+	data := parseFixture(t, "robotics", fixtures["robotics"])
+	summarizeRecord(&data, 1)
+	var record map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(mustJSON(t, data)), &record); err != nil {
+		t.Fatal(err)
+	}
+	for key := range record {
+		if _, ok := schema.Properties[key]; !ok {
+			t.Errorf("record field %q is not in the schema", key)
+		}
+	}
+	for _, key := range schema.Required {
+		if _, ok := record[key]; !ok {
+			t.Errorf("required field %q is missing from the record", key)
+		}
+	}
+
+	var sections []map[string]json.RawMessage
+	if err := json.Unmarshal(record["sections"], &sections); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := sections[0]["summary"]; !ok {
+		t.Error("the lead has no summary")
+	}
+	for key := range sections[0] {
+		if _, ok := schema.Defs["sectionRecord"].Properties[key]; !ok {
+			t.Errorf("section field %q is not in the schema", key)
+		}
+	}
+}
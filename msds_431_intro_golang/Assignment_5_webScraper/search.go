@@ -0,0 +1,269 @@
+package main
+
+import (
+	"encoding/gob"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// BM25 parameters, using the usual defaults.
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// searchDoc is one indexed paragraph.
+type searchDoc struct {
+	URL     string
+	Title   string
+	Section string
+	Text    string
+	Length  int
+}
+
+type posting struct {
+	Doc  int
+	Freq int
+}
+
+// searchIndex is an inverted index over the paragraphs of a scrape,
+// saved to disk with encoding/gob.
+type searchIndex struct {
+	Docs     []searchDoc
+	Postings map[string][]posting
+	AvgLen   float64
+}
+
+// searchResult is a paragraph matching a query with its BM25 score.
+type searchResult struct {
+	Doc     searchDoc
+	Score   float64
+	Snippet string
+}
+
+// buildIndex indexes every non-empty paragraph of the given articles.
+func buildIndex(records []WebsiteData) *searchIndex {
+	idx := &searchIndex{Postings: map[string][]posting{}}
+	total := 0
+	for _, data := range records {
+		for _, sec := range sectionTexts(data) {
+			for _, text := range sec.Paragraphs {
+				terms := analyze(text, englishStopWords)
+				if len(terms) == 0 {
+					continue
+				}
+				doc := len(idx.Docs)
+				idx.Docs = append(idx.Docs, searchDoc{
+					URL:     data.URL,
+					Title:   data.Title,
+					Section: strings.Join(sec.Path, " > "),
+					Text:    text,
+					Length:  len(terms),
+				})
+				total += len(terms)
+
+				freqs := map[string]int{}
+				for _, term := range terms {
+					freqs[term]++
+				}
+				for term, f := range freqs {
+					idx.Postings[term] = append(idx.Postings[term], posting{Doc: doc, Freq: f})
+				}
+			}
+		}
+	}
+	if len(idx.Docs) > 0 {
+		idx.AvgLen = float64(total) / float64(len(idx.Docs))
+	}
+	return idx
+}
+
+// search ranks the indexed paragraphs against query with BM25 and
+// returns the best n.
+func (idx *searchIndex) search(query string, n int) []searchResult {
+	terms := uniqueStrings(analyze(query, englishStopWords))
+	scores := map[int]float64{}
+	N := float64(len(idx.Docs))
+	for _, term := range terms {
+		postings := idx.Postings[term]
+		if len(postings) == 0 {
+			continue
+		}
+		df := float64(len(postings))
+		idf := math.Log(1 + (N-df+0.5)/(df+0.5))
+		for _, p := range postings {
+			tf := float64(p.Freq)
+			norm := 1 - bm25B + bm25B*float64(idx.Docs[p.Doc].Length)/idx.AvgLen
+			scores[p.Doc] += idf * tf * (bm25K1 + 1) / (tf + bm25K1*norm)
+		}
+	}
+
+	results := make([]searchResult, 0, len(scores))
+	for doc, score := range scores {
+		results = append(results, searchResult{Doc: idx.Docs[doc], Score: score})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].Doc.URL < results[j].Doc.URL
+	})
+	if len(results) > n {
+		results = results[:n]
+	}
+	for i := range results {
+		results[i].Snippet = highlight(results[i].Doc.Text, terms, 30)
+	}
+	return results
+}
+
+var wordPattern = regexp.MustCompile(`[\p{L}\p{N}]+`)
+
+// highlight returns a window of about width words around the first
+// matching word of text, with every word whose stem is one of terms
+// wrapped in **.
+func highlight(text string, terms []string, width int) string {
+	want := map[string]bool{}
+	for _, t := range terms {
+		want[t] = true
+	}
+
+	locs := wordPattern.FindAllStringIndex(text, -1)
+	first := -1
+	matched := make([]bool, len(locs))
+	for i, loc := range locs {
+		if want[stem(strings.ToLower(text[loc[0]:loc[1]]))] {
+			matched[i] = true
+			if first < 0 {
+				first = i
+			}
+		}
+	}
+	if len(locs) == 0 {
+		return ""
+	}
+
+	start := 0
+	if first > width/3 {
+		start = first - width/3
+	}
+	end := start + width
+	if end > len(locs) {
+		end = len(locs)
+	}
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("...")
+	}
+	pos := locs[start][0]
+	for i := start; i < end; i++ {
+		b.WriteString(text[pos:locs[i][0]])
+		word := text[locs[i][0]:locs[i][1]]
+		if matched[i] {
+			b.WriteString("**" + word + "**")
+		} else {
+			b.WriteString(word)
+		}
+		pos = locs[i][1]
+	}
+	if end < len(locs) {
+		b.WriteString("...")
+	} else {
+		b.WriteString(text[pos:])
+	}
+	return strings.TrimSpace(b.String())
+}
+
+func uniqueStrings(values []string) []string {
+	seen := map[string]bool{}
+	var out []string
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func saveIndex(fileName string, idx *searchIndex) error {
+	file, err := os.Create(fileName)
+	if err != nil {
+		return fmt.Errorf("failed to create file %s: %w", fileName, err)
+	}
+	defer file.Close()
+	if err := gob.NewEncoder(file).Encode(idx); err != nil {
+		return fmt.Errorf("failed to write index %s: %w", fileName, err)
+	}
+	return nil
+}
+
+func loadIndex(fileName string) (*searchIndex, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file %s: %w", fileName, err)
+	}
+	defer file.Close()
+	var idx searchIndex
+	if err := gob.NewDecoder(file).Decode(&idx); err != nil {
+		return nil, fmt.Errorf("failed to read index %s: %w", fileName, err)
+	}
+	return &idx, nil
+}
+
+// runIndex implements the "index" command.
+func runIndex(args []string) int {
+	fs := flag.NewFlagSet("index", flag.ExitOnError)
+	input := fs.String("input", "wikipedia_data.jsonl", "scraped JSON lines file to index")
+	output := fs.String("index", "wikipedia.idx", "index file to write")
+	fs.Parse(args)
+
+	records, err := readRecords(*input)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	idx := buildIndex(records)
+	if err := saveIndex(*output, idx); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Indexed %d paragraphs (%d terms) from %d articles into %s\n",
+		len(idx.Docs), len(idx.Postings), len(records), *output)
+	return 0
+}
+
+// runSearch implements the "search" command.
+func runSearch(args []string) int {
+	fs := flag.NewFlagSet("search", flag.ExitOnError)
+	indexFile := fs.String("index", "wikipedia.idx", "index file written by the index command")
+	n := fs.Int("n", 10, "number of results to show")
+	fs.Parse(args)
+
+	query := strings.Join(fs.Args(), " ")
+	if query == "" {
+		fmt.Println("Usage: search [-index file] [-n results] <query>")
+		return 2
+	}
+	idx, err := loadIndex(*indexFile)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+
+	results := idx.search(query, *n)
+	if len(results) == 0 {
+		fmt.Printf("No results for %q\n", query)
+		return 0
+	}
+	for i, r := range results {
+		fmt.Printf("%d. %s - %s (score %.2f)\n   %s\n   %s\n\n", i+1, r.Doc.Title, r.Doc.Section, r.Score, r.Doc.URL, r.Snippet)
+	}
+	return 0
+}
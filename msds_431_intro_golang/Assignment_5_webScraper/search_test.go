@@ -0,0 +1,75 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStem(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"caresses", "caress"},
+		{"ponies", "poni"},
+		{"hopping", "hop"},
+		{"relational", "relat"},
+		{"generalizations", "gener"},
+		{"robots", "robot"},
+		{"robotics", "robot"},
+		{"an", "an"},
+		{"naïve", "naïve"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			if got := stem(tt.input); got != tt.expected {
+				t.Errorf("stem(%q) = %q, want %q", tt.input, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestAnalyze(t *testing.T) {
+	got := strings.Join(analyze("The Robots are learning, and they're fast!", englishStopWords), " ")
+	if want := "robot learn re fast"; got != want {
+		t.Errorf("analyze() = %q, want %q", got, want)
+	}
+}
+
+func TestSearchIndex(t *testing.T) {
+	records := []WebsiteData{
+		parseFixture(t, "robotics", fixtures["robotics"]),
+		parseFixture(t, "chatbot", fixtures["chatbot"]),
+	}
+
+	file := filepath.Join(t.TempDir(), "test.idx")
+	if err := saveIndex(file, buildIndex(records)); err != nil {
+		t.Fatal(err)
+	}
+	idx, err := loadIndex(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results := idx.search("cybernetic principles", 5)
+	if len(results) == 0 {
+		t.Fatal("no results")
+	}
+	top := results[0]
+	if top.Doc.Title != "Robotics" || top.Doc.Section != "History" {
+		t.Errorf("top result = %s / %s, want Robotics / History", top.Doc.Title, top.Doc.Section)
+	}
+	if !strings.Contains(top.Snippet, "**cybernetics**") || !strings.Contains(top.Snippet, "**principles**") {
+		t.Errorf("snippet not highlighted: %q", top.Snippet)
+	}
+
+	results = idx.search("Weizenbaum", 5)
+	if len(results) != 1 || results[0].Doc.Section != "History > ELIZA" {
+		t.Errorf("results = %+v, want one hit in History > ELIZA", results)
+	}
+
+	if results := idx.search("the and of", 5); len(results) != 0 {
+		t.Errorf("stop word query returned %d results", len(results))
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Block is a piece of section content that is not a plain paragraph,
+// such as a bulleted list or a blockquote.
+type Block struct {
+	Type    string   `json:"type"` // "list" or "blockquote"
+	Ordered bool     `json:"ordered,omitempty"`
+	Items   []string `json:"items,omitempty"`
+	Text    string   `json:"text,omitempty"`
+}
+
+// Section is one node of an article's heading tree. The lead of the
+// article is a level 1 section titled "main_summary"; every h2..h6
+// heading starts a new section nested under the closest heading above it
+// with a lower level.
+type Section struct {
+	Title      string      `json:"title"`
+	Level      int         `json:"level"`
+	Anchor     string      `json:"anchor,omitempty"`
+	Paragraphs []Paragraph `json:"paragraphs"`
+	Blocks     []Block     `json:"blocks,omitempty"`
+	Tables     []*TableRef `json:"tables,omitempty"`
+	Children   []*Section  `json:"children,omitempty"`
+}
+
+// sectionBuilder turns the elements of an article's content root, visited
+// in document order, into a section tree. The profile says which elements
+// are headings, paragraphs, lists, tables and blockquotes. Links are
+// resolved against base and citation markers are looked up in refs.
+type sectionBuilder struct {
+	base    *url.URL
+	profile *SiteProfile
+	refs    map[string]Reference
+	roots   []*Section
+	stack   []*Section
+	tables  int
+}
+
+func newSectionBuilder(base *url.URL, profile *SiteProfile) *sectionBuilder {
+	lead := &Section{Title: "main_summary", Level: 1, Paragraphs: []Paragraph{}}
+	return &sectionBuilder{base: base, profile: profile, refs: map[string]Reference{}, roots: []*Section{lead}}
+}
+
+// current returns the section that content is being added to.
+func (b *sectionBuilder) current() *Section {
+	if len(b.stack) == 0 {
+		return b.roots[0]
+	}
+	return b.stack[len(b.stack)-1]
+}
+
+// add inspects a single element and records it if it is a heading,
+// paragraph, list, table or blockquote.
+func (b *sectionBuilder) add(s *goquery.Selection) {
+	p := b.profile
+	if p.exclude != nil && s.ClosestMatcher(p.exclude).Length() > 0 {
+		return
+	}
+	switch {
+	case p.Headings.matches(s):
+		b.addHeading(s)
+	case p.Paragraphs.matches(s):
+		text := s.Text()
+		if text != "" && text != "\n" {
+			sec := b.current()
+			sec.Paragraphs = append(sec.Paragraphs, newParagraph(s, b.base, b.refs))
+		}
+	case p.Lists.matches(s):
+		var items []string
+		s.ChildrenFiltered("li").Each(func(_ int, li *goquery.Selection) {
+			// Nested lists are dropped from the item text.
+			item := li.Clone()
+			item.Find("ul, ol").Remove()
+			if text := strings.TrimSpace(item.Text()); text != "" {
+				items = append(items, text)
+			}
+		})
+		if len(items) > 0 {
+			sec := b.current()
+			sec.Blocks = append(sec.Blocks, Block{Type: "list", Ordered: goquery.NodeName(s) == "ol", Items: items})
+		}
+	case p.Tables.matches(s):
+		b.addTable(s)
+	case p.Blockquotes.matches(s):
+		if text := strings.TrimSpace(s.Text()); text != "" {
+			sec := b.current()
+			sec.Blocks = append(sec.Blocks, Block{Type: "blockquote", Text: text})
+		}
+	}
+}
+
+// headingLevel returns 2..6 for h2..h6 and 2 for any other heading
+// element, so that the lead stays the only level 1 section.
+func headingLevel(h *goquery.Selection) int {
+	name := goquery.NodeName(h)
+	if len(name) == 2 && name[0] == 'h' && name[1] >= '2' && name[1] <= '6' {
+		return int(name[1] - '0')
+	}
+	return 2
+}
+
+// addHeading opens a new section for a heading element. Its title is the
+// text of the profile's heading_text element when there is one. Otherwise
+// it is the heading's own text without the heading_strip elements, such
+// as the localized edit links that Wikipedia keeps inside headings.
+func (b *sectionBuilder) addHeading(h *goquery.Selection) {
+	if h.Length() == 0 {
+		return
+	}
+	level := headingLevel(h)
+	title := h
+	var headline *goquery.Selection
+	if b.profile.headingText != nil {
+		headline = h.FindMatcher(b.profile.headingText).First()
+	}
+	if headline != nil && headline.Length() > 0 {
+		title = headline
+	} else if b.profile.headingStrip != nil {
+		title = h.Clone()
+		title.FindMatcher(b.profile.headingStrip).Remove()
+	}
+	sec := &Section{
+		Title:      strings.TrimSpace(title.Text()),
+		Level:      level,
+		Anchor:     firstNonEmpty(title.AttrOr("id", ""), h.AttrOr("id", "")),
+		Paragraphs: []Paragraph{},
+	}
+
+	for len(b.stack) > 0 && b.stack[len(b.stack)-1].Level >= level {
+		b.stack = b.stack[:len(b.stack)-1]
+	}
+	if len(b.stack) == 0 {
+		b.roots = append(b.roots, sec)
+	} else {
+		parent := b.stack[len(b.stack)-1]
+		parent.Children = append(parent.Children, sec)
+	}
+	b.stack = append(b.stack, sec)
+}
+
+// addTable parses a table and attaches it to the current section. The
+// file names are assigned here; the files are written by writeTables.
+func (b *sectionBuilder) addTable(s *goquery.Selection) {
+	sec := b.current()
+	b.tables++
+	pageURL := ""
+	if b.base != nil {
+		pageURL = b.base.String()
+	}
+
+	t := parseTable(s)
+	t.Source = pageURL
+	t.Section = sec.Title
+	name := tableFileBase(pageURL, b.tables)
+	sec.Tables = append(sec.Tables, &TableRef{
+		Caption: t.Caption,
+		CSV:     name + ".csv",
+		JSON:    name + ".json",
+		table:   t,
+	})
+}
+
+// tree returns the top level sections: the lead followed by the h2
+// sections, each carrying its subsections as children.
+func (b *sectionBuilder) tree() []*Section {
+	return b.roots
+}
+
+// flatSections lists every section of the tree in document order with
+// the raw text of its own paragraphs. Subsections follow their parent
+// rather than being folded into it, so their paragraphs appear once.
+func (b *sectionBuilder) flatSections() []SectionRecord {
+	return flattenSections(b.roots)
+}
+
+// flattenSections lists the sections of a tree as flatSections does.
+func flattenSections(roots []*Section) []SectionRecord {
+	var out []SectionRecord
+	var walk func(sec *Section)
+	walk = func(sec *Section) {
+		rec := SectionRecord{Title: sec.Title, Level: sec.Level, Paragraphs: []string{}}
+		for _, p := range sec.Paragraphs {
+			rec.Paragraphs = append(rec.Paragraphs, p.Text)
+		}
+		out = append(out, rec)
+		for _, child := range sec.Children {
+			walk(child)
+		}
+	}
+	for _, root := range roots {
+		walk(root)
+	}
+	return out
+}
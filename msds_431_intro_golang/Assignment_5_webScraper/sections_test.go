@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// buildSections feeds every element below #mw-content-text to a section
+// builder in document order, as the scraper does.
+func buildSections(t *testing.T, body string) *sectionBuilder {
+	t.Helper()
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(`<div id="mw-content-text"><div class="mw-parser-output">` + body + `</div></div>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	base, _ := url.Parse("https://en.wikipedia.org/wiki/Robot")
+	b := newSectionBuilder(base, wikipediaProfile)
+	doc.Find("#mw-content-text").Find("*").Each(func(_ int, s *goquery.Selection) {
+		b.add(s)
+	})
+	return b
+}
+
+// outline lists the sections of a tree, indented by depth, with their
+// heading level and number of paragraphs.
+func outline(secs []*Section, indent string, into []string) []string {
+	for _, sec := range secs {
+		into = append(into, fmt.Sprintf("%sh%d %s: %d", indent, sec.Level, sec.Title, len(sec.Paragraphs)))
+		into = outline(sec.Children, indent+"  ", into)
+	}
+	return into
+}
+
+func heading(level int, title string) string {
+	anchor := strings.ReplaceAll(title, " ", "_")
+	return fmt.Sprintf(`<div class="mw-heading mw-heading%d"><h%d id="%s">%s</h%d></div>`, level, level, anchor, title, level)
+}
+
+func TestSectionTreeNesting(t *testing.T) {
+	b := buildSections(t, `<p>Robots are machines.</p>`+
+		heading(2, "History")+`<p>Early robots.</p>`+
+		heading(3, "Automata")+`<p>Clockwork figures.</p>`+
+		heading(4, "Greek automata")+`<p>Hero of Alexandria.</p>`+
+		heading(3, "Industrial robots")+`<p>Unimate.</p>`+
+		heading(2, "Uses")+
+		heading(4, "Surgery")+`<p>Surgical robots.</p>`+
+		heading(3, "Space")+`<p>Rovers.</p>`+
+		heading(2, "See also"))
+
+	want := []string{
+		"h1 main_summary: 1",
+		"h2 History: 1",
+		"  h3 Automata: 1",
+		"    h4 Greek automata: 1",
+		"  h3 Industrial robots: 1",
+		"h2 Uses: 0",
+		// A skipped level nests under the closest heading above it, and
+		// the next h3 is its sibling rather than its child.
+		"  h4 Surgery: 1",
+		"  h3 Space: 1",
+		"h2 See also: 0",
+	}
+	tree := b.tree()
+	if got := outline(tree, "", nil); !reflect.DeepEqual(got, want) {
+		t.Errorf("section tree:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if anchor := tree[1].Children[0].Children[0].Anchor; anchor != "Greek_automata" {
+		t.Errorf("anchor = %q, want Greek_automata", anchor)
+	}
+
+	// The flat sections list every section in document order, each with
+	// its own paragraphs only.
+	var flat []string
+	for _, sec := range b.flatSections() {
+		flat = append(flat, fmt.Sprintf("h%d %s: %d", sec.Level, sec.Title, len(sec.Paragraphs)))
+	}
+	wantFlat := []string{
+		"h1 main_summary: 1", "h2 History: 1", "h3 Automata: 1", "h4 Greek automata: 1", "h3 Industrial robots: 1",
+		"h2 Uses: 0", "h4 Surgery: 1", "h3 Space: 1", "h2 See also: 0",
+	}
+	if !reflect.DeepEqual(flat, wantFlat) {
+		t.Errorf("flat sections = %q, want %q", flat, wantFlat)
+	}
+}
+
+func TestSectionBlocks(t *testing.T) {
+	b := buildSections(t, `<div class="hatnote"><ul><li>Not to be confused with androids</li></ul></div>
+		<p>Robots are machines.</p>
+		<ul><li>Industrial<ul><li>Welding</li></ul></li><li>Domestic</li></ul>
+		<ol><li>Sense</li><li>Plan</li></ol>
+		<blockquote><p>A robot may not injure a human being.</p></blockquote>
+		<div class="navbox"><ul><li>Robotics navigation</li></ul></div>
+		<ol class="references"><li>A reference</li></ol>`)
+
+	lead := b.tree()[0]
+	if len(lead.Paragraphs) != 1 {
+		t.Errorf("lead has %d paragraphs, want 1; quoted paragraphs belong to the blockquote", len(lead.Paragraphs))
+	}
+	want := []Block{
+		{Type: "list", Items: []string{"Industrial", "Domestic"}},
+		{Type: "list", Ordered: true, Items: []string{"Sense", "Plan"}},
+		{Type: "blockquote", Text: "A robot may not injure a human being."},
+	}
+	if !reflect.DeepEqual(lead.Blocks, want) {
+		t.Errorf("blocks = %+v, want %+v", lead.Blocks, want)
+	}
+}
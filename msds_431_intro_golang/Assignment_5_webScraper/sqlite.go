@@ -0,0 +1,250 @@
+package main
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	_ "modernc.org/sqlite" // Use the cgo-free SQLite library
+)
+
+// recordSink stores scraped records in addition to the JSON lines output.
+// put may be called from several goroutines at once.
+type recordSink interface {
+	put(data WebsiteData) error
+	Close() error
+}
+
+// openSink opens the sink described by spec, e.g. "sqlite:wikipedia.db".
+func openSink(spec string) (recordSink, error) {
+	kind, target, ok := strings.Cut(spec, ":")
+	if !ok || target == "" {
+		return nil, fmt.Errorf("invalid sink %q, want sqlite:path.db", spec)
+	}
+	switch kind {
+	case "sqlite":
+		return openSQLiteSink(target)
+	default:
+		return nil, fmt.Errorf("unknown sink type %q, want sqlite", kind)
+	}
+}
+
+// sqliteSchema creates the tables on first use. paragraphs_fts indexes the
+// citation-free text of paragraphs and is kept in step by triggers.
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS articles (
+	id             INTEGER PRIMARY KEY,
+	url            TEXT NOT NULL UNIQUE,
+	title          TEXT NOT NULL,
+	language       TEXT,
+	wikidata_id    TEXT,
+	schema_version INTEGER NOT NULL,
+	content_hash   TEXT NOT NULL,
+	scraped_at     TEXT NOT NULL,
+	updated_at     TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS sections (
+	id         INTEGER PRIMARY KEY,
+	article_id INTEGER NOT NULL REFERENCES articles(id),
+	parent_id  INTEGER REFERENCES sections(id),
+	position   INTEGER NOT NULL,
+	title      TEXT NOT NULL,
+	level      INTEGER NOT NULL,
+	anchor     TEXT,
+	UNIQUE (article_id, position)
+);
+CREATE TABLE IF NOT EXISTS paragraphs (
+	id         INTEGER PRIMARY KEY,
+	section_id INTEGER NOT NULL REFERENCES sections(id),
+	position   INTEGER NOT NULL,
+	text       TEXT NOT NULL,
+	clean_text TEXT NOT NULL,
+	UNIQUE (section_id, position)
+);
+CREATE VIRTUAL TABLE IF NOT EXISTS paragraphs_fts USING fts5(
+	clean_text, content='paragraphs', content_rowid='id'
+);
+CREATE TRIGGER IF NOT EXISTS paragraphs_ai AFTER INSERT ON paragraphs BEGIN
+	INSERT INTO paragraphs_fts(rowid, clean_text) VALUES (new.id, new.clean_text);
+END;
+CREATE TRIGGER IF NOT EXISTS paragraphs_ad AFTER DELETE ON paragraphs BEGIN
+	INSERT INTO paragraphs_fts(paragraphs_fts, rowid, clean_text) VALUES ('delete', old.id, old.clean_text);
+END;
+`
+
+// sqliteSink writes records into normalized articles, sections and
+// paragraphs tables.
+type sqliteSink struct {
+	mu sync.Mutex
+	db *sql.DB
+}
+
+func openSQLiteSink(path string) (*sqliteSink, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database %s: %w", path, err)
+	}
+	// One connection, so writes are serialized and pragmas stick.
+	db.SetMaxOpenConns(1)
+	for _, stmt := range []string{"PRAGMA journal_mode=WAL", "PRAGMA foreign_keys=ON", sqliteSchema} {
+		if _, err := db.Exec(stmt); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("failed to set up database %s: %w", path, err)
+		}
+	}
+	return &sqliteSink{db: db}, nil
+}
+
+func (s *sqliteSink) Close() error {
+	return s.db.Close()
+}
+
+// contentHash identifies the content of a record, so unchanged articles
+// are not rewritten.
+func contentHash(data WebsiteData) (string, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// put upserts an article by URL. When the stored content hash matches,
+// only scraped_at is updated; otherwise the article row is updated and
+// its sections and paragraphs are replaced.
+func (s *sqliteSink) put(data WebsiteData) error {
+	hash, err := contentHash(data)
+	if err != nil {
+		return fmt.Errorf("failed to hash %s: %w", data.URL, err)
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var id int64
+	var stored string
+	err = tx.QueryRow(`SELECT id, content_hash FROM articles WHERE url = ?`, data.URL).Scan(&id, &stored)
+	switch {
+	case err == sql.ErrNoRows:
+		res, err := tx.Exec(`INSERT INTO articles (url, title, language, wikidata_id, schema_version, content_hash, scraped_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			data.URL, data.Title, data.Language, data.WikidataID, data.SchemaVersion, hash, now, now)
+		if err != nil {
+			return fmt.Errorf("failed to insert %s: %w", data.URL, err)
+		}
+		if id, err = res.LastInsertId(); err != nil {
+			return err
+		}
+	case err != nil:
+		return fmt.Errorf("failed to look up %s: %w", data.URL, err)
+	case stored == hash:
+		if _, err := tx.Exec(`UPDATE articles SET scraped_at = ? WHERE id = ?`, now, id); err != nil {
+			return fmt.Errorf("failed to update %s: %w", data.URL, err)
+		}
+		return tx.Commit()
+	default:
+		_, err := tx.Exec(`UPDATE articles SET title = ?, language = ?, wikidata_id = ?, schema_version = ?, content_hash = ?, scraped_at = ?, updated_at = ?
+			WHERE id = ?`,
+			data.Title, data.Language, data.WikidataID, data.SchemaVersion, hash, now, now, id)
+		if err != nil {
+			return fmt.Errorf("failed to update %s: %w", data.URL, err)
+		}
+		if err := deleteSections(tx, id); err != nil {
+			return fmt.Errorf("failed to replace sections of %s: %w", data.URL, err)
+		}
+	}
+
+	if err := insertSections(tx, id, data); err != nil {
+		return fmt.Errorf("failed to insert sections of %s: %w", data.URL, err)
+	}
+	return tx.Commit()
+}
+
+// deleteSections removes the sections and paragraphs of an article.
+// Foreign keys are checked at the end of each statement, so the sections
+// can go in one statement although they reference each other.
+func deleteSections(tx *sql.Tx, articleID int64) error {
+	if _, err := tx.Exec(`DELETE FROM paragraphs WHERE section_id IN (SELECT id FROM sections WHERE article_id = ?)`, articleID); err != nil {
+		return err
+	}
+	_, err := tx.Exec(`DELETE FROM sections WHERE article_id = ?`, articleID)
+	return err
+}
+
+// insertSections stores the section tree of a record, or its ordered
+// sections when the record has no tree.
+func insertSections(tx *sql.Tx, articleID int64, data WebsiteData) error {
+	insertSection, err := tx.Prepare(`INSERT INTO sections (article_id, parent_id, position, title, level, anchor) VALUES (?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer insertSection.Close()
+	insertParagraph, err := tx.Prepare(`INSERT INTO paragraphs (section_id, position, text, clean_text) VALUES (?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer insertParagraph.Close()
+
+	position := 0
+	add := func(parent sql.NullInt64, title string, level int, anchor string, paragraphs []Paragraph) (int64, error) {
+		res, err := insertSection.Exec(articleID, parent, position, title, level, anchor)
+		if err != nil {
+			return 0, err
+		}
+		position++
+		id, err := res.LastInsertId()
+		if err != nil {
+			return 0, err
+		}
+		for i, p := range paragraphs {
+			clean := p.CleanText
+			if clean == "" {
+				clean = strings.TrimSpace(p.Text)
+			}
+			if _, err := insertParagraph.Exec(id, i, p.Text, clean); err != nil {
+				return 0, err
+			}
+		}
+		return id, nil
+	}
+
+	if len(data.SectionTree) == 0 {
+		for _, sec := range data.Sections {
+			var paragraphs []Paragraph
+			for _, text := range sec.Paragraphs {
+				paragraphs = append(paragraphs, Paragraph{Text: text})
+			}
+			if _, err := add(sql.NullInt64{}, sec.Title, sec.Level, "", paragraphs); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var walk func(parent sql.NullInt64, secs []*Section) error
+	walk = func(parent sql.NullInt64, secs []*Section) error {
+		for _, sec := range secs {
+			id, err := add(parent, sec.Title, sec.Level, sec.Anchor, sec.Paragraphs)
+			if err != nil {
+				return err
+			}
+			if err := walk(sql.NullInt64{Int64: id, Valid: true}, sec.Children); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return walk(sql.NullInt64{}, data.SectionTree)
+}
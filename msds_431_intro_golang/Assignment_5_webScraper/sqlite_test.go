@@ -0,0 +1,74 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestOpenSink(t *testing.T) {
+	for _, spec := range []string{"sqlite", "sqlite:", "postgres:db"} {
+		if _, err := openSink(spec); err == nil {
+			t.Errorf("openSink(%q) succeeded, want an error", spec)
+		}
+	}
+}
+
+func TestSQLiteSinkUpsert(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wikipedia.db")
+	sink, err := openSQLiteSink(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	count := func(query string, args ...interface{}) int {
+		t.Helper()
+		var n int
+		if err := sink.db.QueryRow(query, args...).Scan(&n); err != nil {
+			t.Fatalf("%s: %v", query, err)
+		}
+		return n
+	}
+
+	robotics := parseFixture(t, "robotics", fixtures["robotics"])
+	chatbot := parseFixture(t, "chatbot", fixtures["chatbot"])
+	for _, data := range []WebsiteData{robotics, chatbot, robotics} {
+		if err := sink.put(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n := count(`SELECT COUNT(*) FROM articles`); n != 2 {
+		t.Errorf("articles = %d, want 2", n)
+	}
+	sections := count(`SELECT COUNT(*) FROM sections`)
+	paragraphs := count(`SELECT COUNT(*) FROM paragraphs`)
+	if want := len(robotics.Sections) + len(chatbot.Sections); sections != want {
+		t.Errorf("sections = %d, want %d", sections, want)
+	}
+	if n := count(`SELECT COUNT(*) FROM sections s JOIN sections p ON s.parent_id = p.id WHERE s.title = 'Power source' AND p.title = 'Robotics aspects'`); n != 1 {
+		t.Errorf("Power source is not stored under Robotics aspects")
+	}
+	if n := count(`SELECT COUNT(*) FROM paragraphs_fts WHERE paragraphs_fts MATCH 'cybernetics'`); n != 1 {
+		t.Errorf("full text matches for cybernetics = %d, want 1", n)
+	}
+
+	// A changed article replaces its rows instead of adding new ones.
+	robotics.Title = "Robotics (updated)"
+	robotics.SectionTree[2].Paragraphs = robotics.SectionTree[2].Paragraphs[:0]
+	if err := sink.put(robotics); err != nil {
+		t.Fatal(err)
+	}
+	if n := count(`SELECT COUNT(*) FROM articles WHERE title = ?`, "Robotics (updated)"); n != 1 {
+		t.Errorf("updated article rows = %d, want 1", n)
+	}
+	if n := count(`SELECT COUNT(*) FROM sections`); n != sections {
+		t.Errorf("sections after update = %d, want %d", n, sections)
+	}
+	if n := count(`SELECT COUNT(*) FROM paragraphs`); n != paragraphs-1 {
+		t.Errorf("paragraphs after update = %d, want %d", n, paragraphs-1)
+	}
+	if n := count(`SELECT COUNT(*) FROM paragraphs_fts WHERE paragraphs_fts MATCH 'cybernetics'`); n != 0 {
+		t.Errorf("full text matches for a removed paragraph = %d, want 0", n)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// stateFileName is where a scrape records which of its URLs are done.
+const stateFileName = "wikipedia_data.state.json"
+
+// crawlState lists the URLs of a run that produced a record and the ones
+// that did not, because the run was interrupted or the page failed.
+// --resume scrapes the pending URLs.
+type crawlState struct {
+	Completed []string `json:"completed"`
+	Pending   []string `json:"pending"`
+}
+
+// newCrawlState splits urls, keeping their order, by whether records has
+// a record for them.
+func newCrawlState(urls []string, records []WebsiteData) crawlState {
+	return crawlState{Pending: urls}.advance(records)
+}
+
+// advance returns the state after a run over the pending URLs that
+// produced records: the pending URLs with a record join the completed
+// ones, keeping their order. URLs completed by earlier runs stay
+// completed, so the state of a resumed run still lists them.
+func (s crawlState) advance(records []WebsiteData) crawlState {
+	done := map[string]bool{}
+	for _, data := range records {
+		done[data.URL] = true
+	}
+	next := crawlState{Completed: append([]string{}, s.Completed...), Pending: []string{}}
+	for _, u := range s.Pending {
+		if done[u] {
+			next.Completed = append(next.Completed, u)
+		} else {
+			next.Pending = append(next.Pending, u)
+		}
+	}
+	return next
+}
+
+// urls returns every URL of the crawl, the completed ones first.
+func (s crawlState) urls() []string {
+	return append(append([]string{}, s.Completed...), s.Pending...)
+}
+
+func (s crawlState) save(fileName string) error {
+	raw, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(fileName, raw); err != nil {
+		return fmt.Errorf("failed to write %s: %w", fileName, err)
+	}
+	return nil
+}
+
+func loadCrawlState(fileName string) (crawlState, error) {
+	var s crawlState
+	raw, err := os.ReadFile(fileName)
+	if err != nil {
+		return s, fmt.Errorf("failed to read crawl state: %w", err)
+	}
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return s, fmt.Errorf("invalid crawl state in %s: %w", fileName, err)
+	}
+	return s, nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// TestScrapeInterrupted cancels the crawl as soon as the first page is
+// requested: that page still completes, and the others stay pending.
+func TestScrapeInterrupted(t *testing.T) {
+	fixtures := newFixtureServer(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var once sync.Once
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		once.Do(cancel)
+		http.Redirect(w, r, fixtures.URL+r.URL.Path, http.StatusTemporaryRedirect)
+	}))
+	defer srv.Close()
+
+	urls := []string{srv.URL + "/wiki/Robotics", srv.URL + "/wiki/Chatbot", srv.URL + "/wiki/Robotik"}
+	var buf bytes.Buffer
+	records := scrape(ctx, urls, &buf, scrapeOptions{outDir: t.TempDir()})
+
+	if len(records) != 1 || records[0].URL != urls[0] {
+		t.Fatalf("got %d records, want only %s", len(records), urls[0])
+	}
+	if lines := bytes.Count(buf.Bytes(), []byte("\n")); lines != 1 {
+		t.Errorf("output has %d lines, want 1", lines)
+	}
+
+	state := newCrawlState(urls, records)
+	want := crawlState{Completed: urls[:1], Pending: urls[1:]}
+	if !reflect.DeepEqual(state, want) {
+		t.Errorf("state = %+v, want %+v", state, want)
+	}
+
+	file := filepath.Join(t.TempDir(), "state.json")
+	if err := state.save(file); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := loadCrawlState(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded, state) {
+		t.Errorf("loaded state = %+v, want %+v", loaded, state)
+	}
+}
+
+// TestScrapeResumeInterruptedTwice interrupts a crawl, resumes it and
+// interrupts it again. The state saved by the resumed run still lists
+// the pages the first run completed, and a last resume finishes the
+// crawl without scraping them again.
+func TestScrapeResumeInterruptedTwice(t *testing.T) {
+	fixtures := newFixtureServer(t)
+	var mu sync.Mutex
+	var interrupt context.CancelFunc
+	var requested []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requested = append(requested, r.URL.Path)
+		if interrupt != nil {
+			interrupt()
+			interrupt = nil
+		}
+		mu.Unlock()
+		http.Redirect(w, r, fixtures.URL+r.URL.Path, http.StatusTemporaryRedirect)
+	}))
+	defer srv.Close()
+
+	urls := []string{srv.URL + "/wiki/Robotics", srv.URL + "/wiki/Chatbot", srv.URL + "/wiki/Robotik"}
+	file := filepath.Join(t.TempDir(), "state.json")
+	state := crawlState{Pending: urls}
+	wantCompleted := [][]string{urls[:1], urls[:2], urls}
+	for run, want := range wantCompleted {
+		ctx, cancel := context.WithCancel(context.Background())
+		if run < 2 {
+			mu.Lock()
+			interrupt = cancel
+			mu.Unlock()
+		}
+		records := scrape(ctx, state.Pending, &bytes.Buffer{}, scrapeOptions{outDir: t.TempDir()})
+		cancel()
+
+		if err := state.advance(records).save(file); err != nil {
+			t.Fatal(err)
+		}
+		var err error
+		if state, err = loadCrawlState(file); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(state.Completed, want) || !reflect.DeepEqual(state.urls(), urls) {
+			t.Fatalf("state after run %d = %+v, want %v completed", run+1, state, want)
+		}
+	}
+	if len(state.Pending) != 0 {
+		t.Errorf("pending after the last run = %v", state.Pending)
+	}
+	if want := []string{"/wiki/Robotics", "/wiki/Chatbot", "/wiki/Robotik"}; !reflect.DeepEqual(requested, want) {
+		t.Errorf("requested %v, want every page once", requested)
+	}
+}
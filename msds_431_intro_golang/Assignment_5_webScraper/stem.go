@@ -0,0 +1,224 @@
+package main
+
+import "strings"
+
+// stem reduces an English word to its stem with the Porter (1980)
+// algorithm, so that "robots", "robotic" and "robotics" share a term.
+// Words that are not plain lower case ASCII are returned unchanged.
+func stem(word string) string {
+	if len(word) <= 2 {
+		return word
+	}
+	for i := 0; i < len(word); i++ {
+		if word[i] < 'a' || word[i] > 'z' {
+			return word
+		}
+	}
+
+	w := []byte(word)
+	w = step1a(w)
+	w = step1b(w)
+	w = step1c(w)
+	w = stepSuffixes(w, step2Rules)
+	w = stepSuffixes(w, step3Rules)
+	w = step4(w)
+	w = step5(w)
+	return string(w)
+}
+
+// isConsonant reports whether w[i] is a consonant. 'y' is a consonant
+// unless it follows another consonant.
+func isConsonant(w []byte, i int) bool {
+	switch w[i] {
+	case 'a', 'e', 'i', 'o', 'u':
+		return false
+	case 'y':
+		return i == 0 || !isConsonant(w, i-1)
+	}
+	return true
+}
+
+// measure counts the VC sequences in w, the m of [C](VC){m}[V].
+func measure(w []byte) int {
+	m := 0
+	i := 0
+	for i < len(w) && isConsonant(w, i) {
+		i++
+	}
+	for i < len(w) {
+		for i < len(w) && !isConsonant(w, i) {
+			i++
+		}
+		if i >= len(w) {
+			break
+		}
+		for i < len(w) && isConsonant(w, i) {
+			i++
+		}
+		m++
+	}
+	return m
+}
+
+func hasVowel(w []byte) bool {
+	for i := range w {
+		if !isConsonant(w, i) {
+			return true
+		}
+	}
+	return false
+}
+
+// endsDoubleConsonant is the *d condition.
+func endsDoubleConsonant(w []byte) bool {
+	n := len(w)
+	return n >= 2 && w[n-1] == w[n-2] && isConsonant(w, n-1)
+}
+
+// endsCVC is the *o condition: consonant-vowel-consonant where the last
+// consonant is not w, x or y.
+func endsCVC(w []byte) bool {
+	n := len(w)
+	if n < 3 || !isConsonant(w, n-3) || isConsonant(w, n-2) || !isConsonant(w, n-1) {
+		return false
+	}
+	c := w[n-1]
+	return c != 'w' && c != 'x' && c != 'y'
+}
+
+func hasSuffix(w []byte, suffix string) bool {
+	return strings.HasSuffix(string(w), suffix)
+}
+
+func step1a(w []byte) []byte {
+	switch {
+	case hasSuffix(w, "sses"):
+		return w[:len(w)-2]
+	case hasSuffix(w, "ies"):
+		return w[:len(w)-2]
+	case hasSuffix(w, "ss"):
+		return w
+	case hasSuffix(w, "s"):
+		return w[:len(w)-1]
+	}
+	return w
+}
+
+func step1b(w []byte) []byte {
+	if hasSuffix(w, "eed") {
+		if measure(w[:len(w)-3]) > 0 {
+			return w[:len(w)-1]
+		}
+		return w
+	}
+
+	var stemmed []byte
+	switch {
+	case hasSuffix(w, "ed") && hasVowel(w[:len(w)-2]):
+		stemmed = w[:len(w)-2]
+	case hasSuffix(w, "ing") && hasVowel(w[:len(w)-3]):
+		stemmed = w[:len(w)-3]
+	default:
+		return w
+	}
+
+	switch {
+	case hasSuffix(stemmed, "at"), hasSuffix(stemmed, "bl"), hasSuffix(stemmed, "iz"):
+		return append(stemmed, 'e')
+	case endsDoubleConsonant(stemmed):
+		last := stemmed[len(stemmed)-1]
+		if last != 'l' && last != 's' && last != 'z' {
+			return stemmed[:len(stemmed)-1]
+		}
+	case measure(stemmed) == 1 && endsCVC(stemmed):
+		return append(stemmed, 'e')
+	}
+	return stemmed
+}
+
+func step1c(w []byte) []byte {
+	if hasSuffix(w, "y") && hasVowel(w[:len(w)-1]) {
+		w[len(w)-1] = 'i'
+	}
+	return w
+}
+
+type suffixRule struct {
+	suffix, replacement string
+}
+
+// Rules for step 2; the longest matching suffix wins.
+var step2Rules = []suffixRule{
+	{"ational", "ate"}, {"tional", "tion"}, {"enci", "ence"}, {"anci", "ance"},
+	{"izer", "ize"}, {"bli", "ble"}, {"alli", "al"}, {"entli", "ent"},
+	{"eli", "e"}, {"ousli", "ous"}, {"ization", "ize"}, {"ation", "ate"},
+	{"ator", "ate"}, {"alism", "al"}, {"iveness", "ive"}, {"fulness", "ful"},
+	{"ousness", "ous"}, {"aliti", "al"}, {"iviti", "ive"}, {"biliti", "ble"},
+	{"logi", "log"},
+}
+
+var step3Rules = []suffixRule{
+	{"icate", "ic"}, {"ative", ""}, {"alize", "al"}, {"iciti", "ic"},
+	{"ical", "ic"}, {"ful", ""}, {"ness", ""},
+}
+
+// stepSuffixes replaces the longest matching suffix when the remaining
+// stem has a measure above zero. Only one rule is ever considered.
+func stepSuffixes(w []byte, rules []suffixRule) []byte {
+	best := -1
+	for i, r := range rules {
+		if hasSuffix(w, r.suffix) && (best < 0 || len(r.suffix) > len(rules[best].suffix)) {
+			best = i
+		}
+	}
+	if best < 0 {
+		return w
+	}
+	r := rules[best]
+	stemmed := w[:len(w)-len(r.suffix)]
+	if measure(stemmed) > 0 {
+		return append(stemmed, r.replacement...)
+	}
+	return w
+}
+
+var step4Suffixes = []string{
+	"al", "ance", "ence", "er", "ic", "able", "ible", "ant", "ement", "ment",
+	"ent", "ion", "ou", "ism", "ate", "iti", "ous", "ive", "ize",
+}
+
+func step4(w []byte) []byte {
+	best := ""
+	for _, s := range step4Suffixes {
+		if hasSuffix(w, s) && len(s) > len(best) {
+			best = s
+		}
+	}
+	if best == "" {
+		return w
+	}
+	stemmed := w[:len(w)-len(best)]
+	if measure(stemmed) <= 1 {
+		return w
+	}
+	if best == "ion" {
+		if len(stemmed) == 0 || (stemmed[len(stemmed)-1] != 's' && stemmed[len(stemmed)-1] != 't') {
+			return w
+		}
+	}
+	return stemmed
+}
+
+func step5(w []byte) []byte {
+	if hasSuffix(w, "e") {
+		stemmed := w[:len(w)-1]
+		m := measure(stemmed)
+		if m > 1 || (m == 1 && !endsCVC(stemmed)) {
+			w = stemmed
+		}
+	}
+	if measure(w) > 1 && endsDoubleConsonant(w) && w[len(w)-1] == 'l' {
+		w = w[:len(w)-1]
+	}
+	return w
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// summaryDamping is the TextRank damping factor, as in PageRank.
+const summaryDamping = 0.85
+
+// maxRankedSentences bounds the sentences that TextRank compares pairwise.
+// Summaries of longer texts are taken from their first sentences, which
+// keeps summarizing a very long article from slowing down the crawl.
+const maxRankedSentences = 300
+
+// abbreviations end with a period without ending the sentence.
+var abbreviations = map[string]bool{
+	"al": true, "approx": true, "ca": true, "cf": true, "co": true, "corp": true, "dr": true,
+	"fig": true, "inc": true, "jr": true, "ltd": true, "mr": true, "mrs": true, "ms": true,
+	"no": true, "prof": true, "sr": true, "st": true, "vol": true, "vs": true,
+}
+
+// splitSentences splits text into sentences at ".", "!" and "?" followed
+// by a word that starts with an upper case letter, a digit or a quote.
+// Initials ("J. R. R. Tolkien"), dotted abbreviations ("U.S.", "e.g.")
+// and common abbreviations such as "Dr." do not end a sentence.
+func splitSentences(text string) []string {
+	words := strings.Fields(text)
+	var sentences []string
+	start := 0
+	for i, word := range words {
+		if i+1 < len(words) && !endsSentence(word, words[i+1]) {
+			continue
+		}
+		sentences = append(sentences, strings.Join(words[start:i+1], " "))
+		start = i + 1
+	}
+	return sentences
+}
+
+// endsSentence reports whether a sentence ends with word, given the word
+// after it.
+func endsSentence(word, next string) bool {
+	word = strings.TrimRight(word, `"')]”’`)
+	if word == "" {
+		return false
+	}
+	switch word[len(word)-1] {
+	case '!', '?':
+	case '.':
+		abbr := strings.ToLower(strings.TrimLeft(word[:len(word)-1], `"'([“‘`))
+		if abbreviations[abbr] || len([]rune(abbr)) == 1 || strings.Contains(abbr, ".") {
+			return false
+		}
+	default:
+		return false
+	}
+	first := []rune(strings.TrimLeft(next, `"'([“‘`))
+	return len(first) > 0 && (unicode.IsUpper(first[0]) || unicode.IsDigit(first[0]))
+}
+
+// sentenceTerms are the distinct terms of a sentence together with the
+// number of terms it has.
+type sentenceTerms struct {
+	set   map[string]bool
+	count int
+}
+
+func newSentenceTerms(terms []string) sentenceTerms {
+	set := make(map[string]bool, len(terms))
+	for _, t := range terms {
+		set[t] = true
+	}
+	return sentenceTerms{set: set, count: len(terms)}
+}
+
+// sentenceSimilarity is the TextRank similarity of two sentences: the
+// number of terms they share, normalized by their lengths. One is added
+// to each length so that one-word sentences do not divide by zero.
+func sentenceSimilarity(a, b sentenceTerms) float64 {
+	if a.count == 0 || b.count == 0 {
+		return 0
+	}
+	if len(a.set) > len(b.set) {
+		a, b = b, a
+	}
+	shared := 0
+	for t := range a.set {
+		if b.set[t] {
+			shared++
+		}
+	}
+	return float64(shared) / (math.Log(float64(a.count+1)) + math.Log(float64(b.count+1)))
+}
+
+// textRank scores sentences by ranking the graph whose edges are weighted
+// by the similarity of the sentences they join. Sentences similar to many
+// others score high. terms holds the analyzed terms of every sentence.
+func textRank(terms [][]string) []float64 {
+	n := len(terms)
+	sentences := make([]sentenceTerms, n)
+	for i, t := range terms {
+		sentences[i] = newSentenceTerms(t)
+	}
+	weights := make([][]float64, n)
+	totals := make([]float64, n)
+	for i := range weights {
+		weights[i] = make([]float64, n)
+	}
+	for i := 0; i < n; i++ {
+		for j := i + 1; j < n; j++ {
+			w := sentenceSimilarity(sentences[i], sentences[j])
+			weights[i][j], weights[j][i] = w, w
+			totals[i] += w
+			totals[j] += w
+		}
+	}
+
+	scores := make([]float64, n)
+	for i := range scores {
+		scores[i] = 1
+	}
+	next := make([]float64, n)
+	for iter := 0; iter < 100; iter++ {
+		change := 0.0
+		for i := 0; i < n; i++ {
+			sum := 0.0
+			for j := 0; j < n; j++ {
+				if weights[j][i] > 0 {
+					sum += weights[j][i] / totals[j] * scores[j]
+				}
+			}
+			next[i] = 1 - summaryDamping + summaryDamping*sum
+			change += math.Abs(next[i] - scores[i])
+		}
+		scores, next = next, scores
+		if change < 1e-6 {
+			break
+		}
+	}
+	return scores
+}
+
+// summarize returns the n highest ranked sentences in their original
+// order, joined by spaces. Texts of n sentences or fewer need no summary
+// and give "". Only the first maxRankedSentences sentences are ranked.
+func summarize(sentences []string, n int, analyzeText func(string) []string) string {
+	if n <= 0 || len(sentences) <= n {
+		return ""
+	}
+	if len(sentences) > maxRankedSentences {
+		sentences = sentences[:maxRankedSentences]
+	}
+	terms := make([][]string, len(sentences))
+	for i, s := range sentences {
+		terms[i] = analyzeText(s)
+	}
+	scores := textRank(terms)
+
+	order := make([]int, len(sentences))
+	for i := range order {
+		order[i] = i
+	}
+	// Ties go to the earlier sentence.
+	sort.SliceStable(order, func(a, b int) bool { return scores[order[a]] > scores[order[b]] })
+	top := order[:n]
+	sort.Ints(top)
+	picked := make([]string, n)
+	for i, idx := range top {
+		picked[i] = sentences[idx]
+	}
+	return strings.Join(picked, " ")
+}
+
+// summarizeRecord sets the summary of an article and of each of its
+// sections that is longer than n sentences, from the citation-free text.
+// English text is compared by stemmed terms without stop words; other
+// languages by their plain words.
+func summarizeRecord(data *WebsiteData, n int) {
+	analyzeText := func(s string) []string { return analyze(s, englishStopWords) }
+	if data.Language != "" && data.Language != "en" {
+		analyzeText = tokenize
+	}
+
+	var all []string
+	for i, sec := range sectionTexts(*data) {
+		var sentences []string
+		for _, p := range sec.Paragraphs {
+			sentences = append(sentences, splitSentences(p)...)
+		}
+		all = append(all, sentences...)
+		if i < len(data.Sections) {
+			data.Sections[i].Summary = summarize(sentences, n, analyzeText)
+		}
+	}
+	data.Summary = summarize(all, n, analyzeText)
+}
+
+// runSummarize implements the "summarize" command, which adds summaries
+// to the records of an earlier scrape, or replaces them with summaries of
+// another length.
+func runSummarize(args []string) int {
+	fs := flag.NewFlagSet("summarize", flag.ExitOnError)
+	input := fs.String("input", "wikipedia_data.jsonl", "scraped JSON lines file to summarize")
+	output := fs.String("output", "", "file to write; empty rewrites -input")
+	sentences := fs.Int("sentences", 3, "sentences per summary; 0 removes the summaries")
+	fs.Parse(args)
+
+	if *sentences < 0 {
+		fmt.Println("Error: -sentences must not be negative")
+		return 2
+	}
+	if *output == "" {
+		*output = *input
+	}
+	records, err := readRecords(*input)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+
+	summarized := 0
+	for i := range records {
+		summarizeRecord(&records[i], *sentences)
+		if records[i].Summary != "" {
+			summarized++
+		}
+	}
+	if err := writeJSONLFile(*output, records); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Summarized %d of %d articles in %s\n", summarized, len(records), *output)
+	return 0
+}
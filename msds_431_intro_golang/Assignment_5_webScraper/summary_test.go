@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// assemblyLines has three sentences about the same topic and two
+// unrelated ones, which TextRank must leave out of a summary.
+var assemblyLines = []string{
+	"Industrial robots weld car bodies on assembly lines.",
+	"The weather in Chicago was cold last winter.",
+	"Robots on assembly lines weld and paint car bodies.",
+	"Assembly lines use industrial robots for welding.",
+	"A cat slept all afternoon.",
+}
+
+func TestSplitSentences(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected []string
+	}{
+		{"One sentence without a period", []string{"One sentence without a period"}},
+		{"First one. Second one! Third one? Fourth.", []string{"First one.", "Second one!", "Third one?", "Fourth."}},
+		{"Dr. Smith met J. R. R. Tolkien in 1950. They talked.", []string{"Dr. Smith met J. R. R. Tolkien in 1950.", "They talked."}},
+		{"The U.S. Army paid $3.5 million. It was 1961.", []string{"The U.S. Army paid $3.5 million.", "It was 1961."}},
+		{`He said "Stop." Then he left, e.g. to rest.`, []string{`He said "Stop."`, "Then he left, e.g. to rest."}},
+		{"It ends with a.k.a. the robot. not capitalized.", []string{"It ends with a.k.a. the robot. not capitalized."}},
+		{"  ", nil},
+	}
+	for _, tt := range tests {
+		if got := splitSentences(tt.text); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("splitSentences(%q) = %q, want %q", tt.text, got, tt.expected)
+		}
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	analyzeText := func(s string) []string { return analyze(s, englishStopWords) }
+	got := summarize(assemblyLines, 2, analyzeText)
+	expected := assemblyLines[0] + " " + assemblyLines[2]
+	if got != expected {
+		t.Errorf("summarize() = %q, want %q", got, expected)
+	}
+
+	scores := textRank([][]string{{"a"}, {"b"}})
+	if scores[0] != 1-summaryDamping || scores[1] != scores[0] {
+		t.Errorf("unconnected sentences scored %v, want %g each", scores, 1-summaryDamping)
+	}
+	if got := summarize(assemblyLines[:2], 2, analyzeText); got != "" {
+		t.Errorf("a text no longer than the summary gave %q", got)
+	}
+	if got := summarize(assemblyLines, 0, analyzeText); got != "" {
+		t.Errorf("a zero-sentence summary gave %q", got)
+	}
+}
+
+// TestSummarizeLongText checks that sentences past maxRankedSentences
+// are not ranked, even when they would rank highest.
+func TestSummarizeLongText(t *testing.T) {
+	var sentences []string
+	for i := 0; i < maxRankedSentences; i++ {
+		sentences = append(sentences, fmt.Sprintf("Filler%d sentence%d.", i, i))
+	}
+	for i := 0; i < 20; i++ {
+		sentences = append(sentences, "Robots weld car bodies.")
+	}
+	got := summarize(sentences, 2, strings.Fields)
+	if want := sentences[0] + " " + sentences[1]; got != want {
+		t.Errorf("summarize() = %q, want %q", got, want)
+	}
+}
+
+func TestSummarizeRecord(t *testing.T) {
+	data := treeRecord("https://en.wikipedia.org/wiki/Industrial_robot", "Industrial robot",
+		section("main_summary", 1, "An industrial robot is a robot system used for manufacturing."),
+		section("Uses", 2, strings.Join(assemblyLines[:3], " "), strings.Join(assemblyLines[3:], " ")))
+	summarizeRecord(&data, 2)
+
+	if data.Sections[0].Summary != "" {
+		t.Errorf("the one-sentence lead got the summary %q", data.Sections[0].Summary)
+	}
+	if expected := assemblyLines[0] + " " + assemblyLines[2]; data.Sections[1].Summary != expected {
+		t.Errorf("Uses summary = %q, want %q", data.Sections[1].Summary, expected)
+	}
+	if n := len(splitSentences(data.Summary)); n != 2 {
+		t.Errorf("article summary %q has %d sentences, want 2", data.Summary, n)
+	}
+
+	summarizeRecord(&data, 0)
+	if data.Summary != "" || data.Sections[1].Summary != "" {
+		t.Error("summarizing with 0 sentences kept the summaries")
+	}
+}
+
+func TestRunSummarize(t *testing.T) {
+	input := filepath.Join(t.TempDir(), "data.jsonl")
+	chatbot := parseFixture(t, "chatbot", fixtures["chatbot"])
+	if err := os.WriteFile(input, []byte(mustJSON(t, chatbot)+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if code := runSummarize([]string{"-input", input, "-sentences", "1"}); code != 0 {
+		t.Fatalf("runSummarize returned %d", code)
+	}
+	records, err := readRecords(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].Summary == "" || len(splitSentences(records[0].Summary)) != 1 {
+		t.Fatalf("records = %+v", records)
+	}
+
+	if code := runSummarize([]string{"-input", input, "-sentences", "0"}); code != 0 {
+		t.Fatalf("runSummarize returned %d", code)
+	}
+	if records, _ := readRecords(input); records[0].Summary != "" {
+		t.Errorf("-sentences 0 kept the summary %q", records[0].Summary)
+	}
+	if code := runSummarize([]string{"-input", input, "-sentences", "-1"}); code != 2 {
+		t.Errorf("runSummarize with -sentences -1 returned %d, want 2", code)
+	}
+}
+
+func TestScrapeSummaries(t *testing.T) {
+	srv := newFixtureServer(t)
+	opts := scrapeOptions{outDir: t.TempDir(), summary: 1}
+	records := scrape(context.Background(), []string{srv.URL + "/wiki/Robotics"}, &bytes.Buffer{}, opts)
+	if len(records) != 1 || records[0].Summary == "" || records[0].Sections[0].Summary == "" {
+		t.Errorf("scrape wrote no summaries: %+v", records)
+	}
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// tablesDir is where the CSV and JSON files of extracted tables go.
+const tablesDir = "tables"
+
+// Table is a wikitable flattened into a rectangular grid. Cells spanning
+// several rows or columns are repeated in every position they cover.
+type Table struct {
+	Source  string     `json:"source"`
+	Section string     `json:"section"`
+	Caption string     `json:"caption,omitempty"`
+	Header  [][]string `json:"header"`
+	Rows    [][]string `json:"rows"`
+}
+
+// TableRef is how a section record points at the files written for one
+// of its tables.
+type TableRef struct {
+	Caption string `json:"caption,omitempty"`
+	CSV     string `json:"csv"`
+	JSON    string `json:"json"`
+
+	table *Table
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+
+// tableFileBase returns the file name prefix for the n-th table of the
+// article at pageURL, e.g. "tables/Chatbot_table3".
+func tableFileBase(pageURL string, n int) string {
+	return path.Join(tablesDir, fmt.Sprintf("%s_table%d", articleFileName(pageURL), n))
+}
+
+// articleFileName returns a file name, without extension, for the
+// article at pageURL, e.g. "Chatbot". Articles of other language editions
+// of Wikipedia get the language as a prefix, e.g. "de_Chatbot", so
+// same-named articles do not collide.
+func articleFileName(pageURL string) string {
+	name := strings.Trim(unsafeFileChars.ReplaceAllString(path.Base(pageURL), "_"), "_")
+	if name == "" {
+		name = "article"
+	}
+	if u, err := url.Parse(pageURL); err == nil {
+		lang, domain, _ := strings.Cut(u.Hostname(), ".")
+		if domain == "wikipedia.org" && lang != "en" {
+			name = lang + "_" + name
+		}
+	}
+	return name
+}
+
+// parseTable converts a table element into a normalized grid, expanding
+// rowspan and colspan. Leading rows made only of <th> cells are header
+// rows.
+func parseTable(s *goquery.Selection) *Table {
+	t := &Table{Header: [][]string{}, Rows: [][]string{}}
+	t.Caption = cellText(s.ChildrenFiltered("caption"))
+
+	type span struct {
+		text string
+		left int
+	}
+	pending := map[int]span{}
+	inHeader := true
+	width := 0
+
+	s.Find("tr").Each(func(_ int, tr *goquery.Selection) {
+		if !tr.ParentsFiltered("table").First().IsSelection(s) {
+			return
+		}
+		var row []string
+		col := 0
+		// consume counts one row off the span pending at col, if any, and
+		// reports its text.
+		consume := func() (string, bool) {
+			p, ok := pending[col]
+			if !ok {
+				return "", false
+			}
+			if p.left--; p.left == 0 {
+				delete(pending, col)
+			} else {
+				pending[col] = p
+			}
+			return p.text, true
+		}
+		fill := func() {
+			for {
+				text, ok := consume()
+				if !ok {
+					return
+				}
+				row = append(row, text)
+				col++
+			}
+		}
+
+		header := true
+		tr.ChildrenFiltered("th, td").Each(func(_ int, cell *goquery.Selection) {
+			fill()
+			if goquery.NodeName(cell) == "td" {
+				header = false
+			}
+			text := cellText(cell)
+			colspan := spanAttr(cell, "colspan")
+			rowspan := spanAttr(cell, "rowspan")
+			if strings.TrimSpace(cell.AttrOr("rowspan", "")) == "0" {
+				// rowspan="0" spans the rest of the table.
+				rowspan = 1000
+			}
+			for k := 0; k < colspan; k++ {
+				// A cell overlapping a span from above takes its place
+				// in this row.
+				consume()
+				row = append(row, text)
+				if rowspan > 1 {
+					pending[col] = span{text: text, left: rowspan - 1}
+				}
+				col++
+			}
+		})
+		// Spans from above continue past the last cell of a short row;
+		// the columns between are left empty.
+		for {
+			fill()
+			next := -1
+			for c := range pending {
+				if c > col && (next < 0 || c < next) {
+					next = c
+				}
+			}
+			if next < 0 {
+				break
+			}
+			for col < next {
+				row = append(row, "")
+				col++
+			}
+		}
+
+		if len(row) == 0 {
+			return
+		}
+		if len(row) > width {
+			width = len(row)
+		}
+		if inHeader && header {
+			t.Header = append(t.Header, row)
+			return
+		}
+		inHeader = false
+		t.Rows = append(t.Rows, row)
+	})
+
+	for _, rows := range [][][]string{t.Header, t.Rows} {
+		for i := range rows {
+			for len(rows[i]) < width {
+				rows[i] = append(rows[i], "")
+			}
+		}
+	}
+	return t
+}
+
+// cellText returns the text of a table cell without citation markers and
+// with whitespace collapsed.
+func cellText(cell *goquery.Selection) string {
+	c := cell.Clone()
+	c.Find(citationMarkers).Remove()
+	return strings.Join(strings.Fields(c.Text()), " ")
+}
+
+func spanAttr(cell *goquery.Selection, name string) int {
+	n, err := strconv.Atoi(strings.TrimSpace(cell.AttrOr(name, "1")))
+	if err != nil || n < 1 {
+		return 1
+	}
+	// Guard against absurd spans in malformed markup.
+	if n > 1000 {
+		return 1000
+	}
+	return n
+}
+
+// writeTables writes every table in the section tree to its CSV and JSON
+// files below dir.
+func writeTables(dir string, sections []*Section) error {
+	for _, sec := range sections {
+		for _, ref := range sec.Tables {
+			if ref.table == nil {
+				continue
+			}
+			if err := writeTableCSV(filepath.Join(dir, ref.CSV), ref.table); err != nil {
+				return err
+			}
+			data, err := json.MarshalIndent(ref.table, "", "    ")
+			if err != nil {
+				return fmt.Errorf("failed to marshal table %s: %w", ref.JSON, err)
+			}
+			if err := os.WriteFile(filepath.Join(dir, ref.JSON), data, 0644); err != nil {
+				return fmt.Errorf("failed to write table %s: %w", ref.JSON, err)
+			}
+		}
+		if err := writeTables(dir, sec.Children); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeTableCSV(name string, t *Table) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %w", name, err)
+	}
+	file, err := os.Create(name)
+	if err != nil {
+		return fmt.Errorf("failed to create file %s: %w", name, err)
+	}
+	defer file.Close()
+
+	records := append(append([][]string{}, t.Header...), t.Rows...)
+	if err := csv.NewWriter(file).WriteAll(records); err != nil {
+		return fmt.Errorf("failed to write CSV file %s: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+func TestParseTableSpans(t *testing.T) {
+	tests := []struct {
+		name   string
+		html   string
+		header [][]string
+		rows   [][]string
+	}{
+		{
+			"rowspan and colspan",
+			`<tr><th>A</th><th colspan="2">B</th></tr>
+			<tr><td rowspan="2">1</td><td>2</td><td>3</td></tr>
+			<tr><td>4</td><td>5</td></tr>`,
+			[][]string{{"A", "B", "B"}},
+			[][]string{{"1", "2", "3"}, {"1", "4", "5"}},
+		},
+		{
+			"short row under a span",
+			`<tr><th>A</th><th>B</th><th>C</th></tr>
+			<tr><td>1</td><td>2</td><td rowspan="3">x</td></tr>
+			<tr><td>3</td></tr>
+			<tr><td>4</td><td>5</td></tr>
+			<tr><td>6</td><td>7</td><td>8</td></tr>`,
+			[][]string{{"A", "B", "C"}},
+			[][]string{{"1", "2", "x"}, {"3", "", "x"}, {"4", "5", "x"}, {"6", "7", "8"}},
+		},
+		{
+			"span past the end of the table",
+			`<tr><td rowspan="5">a</td><td>1</td></tr>
+			<tr><td>2</td></tr>`,
+			[][]string{},
+			[][]string{{"a", "1"}, {"a", "2"}},
+		},
+		{
+			"colspan=0 and invalid spans count as 1",
+			`<tr><td colspan="0">a</td><td colspan="x">b</td><td rowspan="-2">c</td></tr>
+			<tr><td>1</td><td>2</td><td>3</td></tr>`,
+			[][]string{},
+			[][]string{{"a", "b", "c"}, {"1", "2", "3"}},
+		},
+		{
+			"rowspan=0 spans the rest of the table",
+			`<tr><td rowspan="0">a</td><td>1</td></tr>
+			<tr><td>2</td></tr>
+			<tr><td>3</td></tr>`,
+			[][]string{},
+			[][]string{{"a", "1"}, {"a", "2"}, {"a", "3"}},
+		},
+		{
+			"colspan over a span from above",
+			`<tr><td>1</td><td>2</td><td rowspan="3">x</td></tr>
+			<tr><td colspan="3">wide</td></tr>
+			<tr><td>3</td><td>4</td></tr>`,
+			[][]string{},
+			[][]string{{"1", "2", "x"}, {"wide", "wide", "wide"}, {"3", "4", "x"}},
+		},
+		{
+			"nested tables are left out",
+			`<tr><td>1</td><td><table><tr><td>inner</td></tr></table></td></tr>
+			<tr><td>2</td><td>3</td></tr>`,
+			[][]string{},
+			[][]string{{"1", "inner"}, {"2", "3"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := goquery.NewDocumentFromReader(strings.NewReader(`<table class="wikitable">` + tt.html + `</table>`))
+			if err != nil {
+				t.Fatal(err)
+			}
+			table := parseTable(doc.Find("table").First())
+			if !reflect.DeepEqual(table.Header, tt.header) {
+				t.Errorf("header = %q, want %q", table.Header, tt.header)
+			}
+			if !reflect.DeepEqual(table.Rows, tt.rows) {
+				t.Errorf("rows = %q, want %q", table.Rows, tt.rows)
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+// englishStopWords are common words that carry no meaning on their own
+// and are left out of the search index.
+var englishStopWords = newStopWords(`a about above after again against all also am an and any are as at
+be because been before being below between both but by can could did do does doing down during
+each few for from further had has have having he her here hers herself him himself his how i if
+in into is it its itself just me more most my myself no nor not now of off on once only or other
+our ours ourselves out over own same she should so some such than that the their theirs them
+themselves then there these they this those through to too under until up very was we were what
+when where which while who whom why will with would you your yours yourself yourselves`)
+
+// stopWords is a set of lower case words to ignore.
+type stopWords map[string]bool
+
+func newStopWords(list string) stopWords {
+	words := stopWords{}
+	for _, w := range strings.Fields(list) {
+		words[strings.ToLower(w)] = true
+	}
+	return words
+}
+
+// tokenize splits text into lower case words made of letters and digits.
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// analyze turns text into the terms stored in the search index: tokens
+// that are not stop words, reduced to their stem.
+func analyze(text string, stop stopWords) []string {
+	var terms []string
+	for _, tok := range tokenize(text) {
+		if stop[tok] {
+			continue
+		}
+		terms = append(terms, stem(tok))
+	}
+	return terms
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// recordProblem is something wrong with one line of a scrape output.
+// Warnings are reported but do not fail the verification.
+type recordProblem struct {
+	Line    int
+	URL     string
+	Issue   string
+	Warning bool
+}
+
+// verifyResult is what verifyOutput found in a scrape output.
+type verifyResult struct {
+	Records  []WebsiteData
+	Problems []recordProblem
+	Seeds    int      // number of seed URLs; 0 when they are not known
+	Missing  []string // seed URLs without a record
+}
+
+// failed reports whether the output has errors or lacks seed records.
+func (r verifyResult) failed() bool {
+	for _, p := range r.Problems {
+		if !p.Warning {
+			return true
+		}
+	}
+	return len(r.Missing) > 0
+}
+
+// verifyOutput reads every line of a JSON lines scrape output and checks
+// its record. When seeds are given, each of them must have a record.
+func verifyOutput(fileName string, seeds []string) (verifyResult, error) {
+	result := verifyResult{Seeds: len(seeds)}
+	file, err := os.Open(fileName)
+	if err != nil {
+		return result, fmt.Errorf("failed to open file %s: %w", fileName, err)
+	}
+	defer file.Close()
+
+	seen := map[string]int{}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 64<<20)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		problem := func(url, issue string, warning bool) {
+			result.Problems = append(result.Problems, recordProblem{Line: line, URL: url, Issue: issue, Warning: warning})
+		}
+
+		var probe struct {
+			SchemaVersion int `json:"schema_version"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &probe); err != nil {
+			problem("", fmt.Sprintf("invalid JSON: %v", err), false)
+			continue
+		}
+		data, err := decodeRecord(scanner.Bytes())
+		if err != nil {
+			problem("", fmt.Sprintf("invalid record: %v", err), false)
+			continue
+		}
+		result.Records = append(result.Records, data)
+		if probe.SchemaVersion < SchemaVersion {
+			problem(data.URL, fmt.Sprintf("schema version %d is older than %d; run migrate", probe.SchemaVersion, SchemaVersion), true)
+		}
+		for _, issue := range checkRecord(data) {
+			problem(data.URL, issue, false)
+		}
+		if first, ok := seen[data.URL]; ok && data.URL != "" {
+			problem(data.URL, fmt.Sprintf("duplicate of the record on line %d", first), true)
+		} else {
+			seen[data.URL] = line
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return result, fmt.Errorf("failed to read file %s: %w", fileName, err)
+	}
+
+	for _, u := range seeds {
+		if _, ok := seen[u]; !ok {
+			result.Missing = append(result.Missing, u)
+		}
+	}
+	return result, nil
+}
+
+// checkRecord returns what is wrong with the content of a record.
+func checkRecord(data WebsiteData) []string {
+	var issues []string
+	if data.URL == "" {
+		issues = append(issues, "no URL")
+	}
+	if strings.TrimSpace(data.Title) == "" {
+		issues = append(issues, "empty title")
+	}
+	if len(data.Sections) == 0 {
+		issues = append(issues, "no sections")
+		return issues
+	}
+
+	paragraphs := 0
+	for i, sec := range data.Sections {
+		if strings.TrimSpace(sec.Title) == "" {
+			issues = append(issues, fmt.Sprintf("section %d has an empty title", i+1))
+		}
+		if sec.Level < 1 || sec.Level > 6 {
+			issues = append(issues, fmt.Sprintf("section %q has level %d, want 1 to 6", sec.Title, sec.Level))
+		}
+		for _, p := range sec.Paragraphs {
+			if strings.TrimSpace(p) != "" {
+				paragraphs++
+			}
+		}
+	}
+	if paragraphs == 0 {
+		issues = append(issues, "all sections are empty")
+	}
+
+	if data.SectionTree != nil {
+		nodes := 0
+		var count func(secs []*Section)
+		count = func(secs []*Section) {
+			for _, sec := range secs {
+				nodes++
+				count(sec.Children)
+			}
+		}
+		count(data.SectionTree)
+		if nodes != len(data.Sections) {
+			issues = append(issues, fmt.Sprintf("section_tree has %d sections but sections has %d", nodes, len(data.Sections)))
+		}
+	}
+	return issues
+}
+
+// printSummary writes one line per record followed by the problems found
+// and the totals.
+func (r verifyResult) printSummary(w io.Writer, fileName string) {
+	fmt.Fprintf(w, "\nSummary of %s:\n", fileName)
+	for _, data := range r.Records {
+		fmt.Fprintf(w, "- %s: %s (Sections: %d)\n", data.URL, data.Title, len(data.Sections))
+	}
+
+	errors, warnings := 0, 0
+	if len(r.Problems) > 0 {
+		fmt.Fprintln(w, "\nProblems:")
+	}
+	for _, p := range r.Problems {
+		kind := "error"
+		if p.Warning {
+			kind = "warning"
+			warnings++
+		} else {
+			errors++
+		}
+		where := fmt.Sprintf("line %d", p.Line)
+		if p.URL != "" {
+			where += " (" + p.URL + ")"
+		}
+		fmt.Fprintf(w, "  %s: %s: %s\n", kind, where, p.Issue)
+	}
+	for _, u := range r.Missing {
+		fmt.Fprintf(w, "  error: no record for seed %s\n", u)
+	}
+
+	fmt.Fprintf(w, "\n%d records, %d errors, %d warnings", len(r.Records), errors, warnings)
+	if r.Seeds > 0 {
+		fmt.Fprintf(w, "; %d of %d seed URLs scraped", r.Seeds-len(r.Missing), r.Seeds)
+	}
+	fmt.Fprintln(w)
+	if r.failed() {
+		fmt.Fprintln(w, "Verification failed")
+	} else {
+		fmt.Fprintln(w, "Verification passed")
+	}
+}
+
+// runVerify implements the "verify" command, which checks a scrape
+// output. The seed URLs come from the crawl state file when it exists.
+func runVerify(args []string) int {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	input := fs.String("input", "wikipedia_data.jsonl", "scraped JSON lines file to verify")
+	state := fs.String("state", stateFileName, "crawl state file listing the seed URLs; ignored when it does not exist")
+	fs.Parse(args)
+
+	var seeds []string
+	if _, err := os.Stat(*state); err == nil {
+		s, err := loadCrawlState(*state)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		}
+		seeds = append(s.Completed, s.Pending...)
+	}
+
+	result, err := verifyOutput(*input, seeds)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	result.printSummary(os.Stdout, *input)
+	if result.failed() {
+		return 1
+	}
+	return 0
+}
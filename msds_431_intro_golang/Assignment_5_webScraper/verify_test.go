@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCheckRecord(t *testing.T) {
+	robotics := parseFixture(t, "robotics", fixtures["robotics"])
+	lead := SectionRecord{Title: "main_summary", Level: 1, Paragraphs: []string{"Text."}}
+
+	tests := []struct {
+		name string
+		data WebsiteData
+		want []string
+	}{
+		{"fixture", robotics, nil},
+		{"flat only", WebsiteData{URL: "u", Title: "T", Sections: []SectionRecord{lead}}, nil},
+		{"empty title", WebsiteData{URL: "u", Title: " ", Sections: []SectionRecord{lead}}, []string{"empty title"}},
+		{"no sections", WebsiteData{URL: "u", Title: "T"}, []string{"no sections"}},
+		{"empty sections", WebsiteData{URL: "u", Title: "T", Sections: []SectionRecord{
+			{Title: "main_summary", Level: 1, Paragraphs: []string{}},
+			{Title: "", Level: 7, Paragraphs: []string{" "}},
+		}}, []string{"section 2 has an empty title", `section "" has level 7, want 1 to 6`, "all sections are empty"}},
+		{"tree mismatch", WebsiteData{URL: "u", Title: "T", Sections: []SectionRecord{lead, lead}, SectionTree: []*Section{{Title: "main_summary", Level: 1}}},
+			[]string{"section_tree has 1 sections but sections has 2"}},
+	}
+	for _, tt := range tests {
+		if got := checkRecord(tt.data); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: checkRecord = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestVerifyOutput(t *testing.T) {
+	robotics := parseFixture(t, "robotics", fixtures["robotics"])
+	chatbot := parseFixture(t, "chatbot", fixtures["chatbot"])
+	untitled := chatbot
+	untitled.URL, untitled.Title = "https://en.wikipedia.org/wiki/Untitled", ""
+	lines := []string{
+		mustJSON(t, robotics),
+		`{"url": "https://en.wikipedia.org/wiki/Broken", "title": `,
+		mustJSON(t, untitled),
+		"",
+		`{"url": "https://en.wikipedia.org/wiki/Old", "title": "Old", "sections": {"sections": [{"main_summary": {"paragraph": ["Lead."]}}]}}`,
+		mustJSON(t, robotics),
+	}
+	file := filepath.Join(t.TempDir(), "data.jsonl")
+	if err := os.WriteFile(file, []byte(strings.Join(lines, "\n")+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	seeds := []string{robotics.URL, chatbot.URL}
+	result, err := verifyOutput(file, seeds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Records) != 4 {
+		t.Errorf("got %d records, want 4", len(result.Records))
+	}
+	var got []recordProblem
+	for _, p := range result.Problems {
+		if strings.HasPrefix(p.Issue, "invalid JSON") {
+			p.Issue = "invalid JSON"
+		}
+		got = append(got, p)
+	}
+	want := []recordProblem{
+		{Line: 2, Issue: "invalid JSON"},
+		{Line: 3, URL: untitled.URL, Issue: "empty title"},
+		{Line: 5, URL: "https://en.wikipedia.org/wiki/Old", Issue: "schema version 0 is older than 2; run migrate", Warning: true},
+		{Line: 6, URL: robotics.URL, Issue: "duplicate of the record on line 1", Warning: true},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("problems =\n%+v\nwant\n%+v", got, want)
+	}
+	if !reflect.DeepEqual(result.Missing, []string{chatbot.URL}) {
+		t.Errorf("missing = %v, want [%s]", result.Missing, chatbot.URL)
+	}
+	if !result.failed() {
+		t.Error("verification passed, want it to fail")
+	}
+
+	var buf bytes.Buffer
+	result.printSummary(&buf, file)
+	for _, line := range []string{
+		"- https://en.wikipedia.org/wiki/Robotics: Robotics (Sections: 6)",
+		"  error: line 3 (https://en.wikipedia.org/wiki/Untitled): empty title",
+		"  error: no record for seed https://en.wikipedia.org/wiki/Chatbot",
+		"4 records, 2 errors, 2 warnings; 1 of 2 seed URLs scraped",
+		"Verification failed",
+	} {
+		if !strings.Contains(buf.String(), line+"\n") {
+			t.Errorf("summary lacks %q:\n%s", line, buf.String())
+		}
+	}
+}
+
+func TestRunVerify(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "data.jsonl")
+	robotics := parseFixture(t, "robotics", fixtures["robotics"])
+	if err := os.WriteFile(input, []byte(mustJSON(t, robotics)+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	state := filepath.Join(dir, "state.json")
+	if code := runVerify([]string{"-input", input, "-state", state}); code != 0 {
+		t.Errorf("without a state file: exit code %d, want 0", code)
+	}
+	crawlState{Completed: []string{robotics.URL}, Pending: []string{}}.save(state)
+	if code := runVerify([]string{"-input", input, "-state", state}); code != 0 {
+		t.Errorf("with every seed scraped: exit code %d, want 0", code)
+	}
+	crawlState{Completed: []string{robotics.URL}, Pending: []string{fixtures["chatbot"]}}.save(state)
+	if code := runVerify([]string{"-input", input, "-state", state}); code != 1 {
+		t.Errorf("with a pending seed: exit code %d, want 1", code)
+	}
+}
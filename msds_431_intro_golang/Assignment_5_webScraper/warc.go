@@ -0,0 +1,500 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// warcRecord is one record of a WARC 1.1 file. Block is the record's
+// content: the HTTP message for request and response records.
+type warcRecord struct {
+	Type          string // warcinfo, request, response or metadata
+	ID            string // urn:uuid:...
+	Date          time.Time
+	TargetURI     string
+	ConcurrentTo  string // for a request or metadata record, the ID of its response
+	ContentType   string
+	PayloadDigest string // for a response, the digest of its body
+	Block         []byte
+}
+
+// warcWriter appends records to a WARC file. Every record is compressed
+// as a gzip member of its own, as is usual for .warc.gz files, so tools
+// can seek to a record and a resumed run can append to the file.
+type warcWriter struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// newWARCWriter creates the WARC file, or appends to it, and writes a
+// warcinfo record describing the run.
+func newWARCWriter(fileName string, appendTo bool) (*warcWriter, error) {
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if appendTo {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	}
+	file, err := os.OpenFile(fileName, flags, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create WARC file %s: %w", fileName, err)
+	}
+	w := &warcWriter{file: file}
+	info := "software: go-web-crawler\r\nformat: WARC File Format 1.1\r\n" +
+		"conformsTo: https://iipc.github.io/warc-specifications/specifications/warc-format/warc-1.1/\r\n"
+	err = w.write(warcRecord{
+		Type:        "warcinfo",
+		ID:          newRecordID(),
+		Date:        time.Now().UTC(),
+		ContentType: "application/warc-fields",
+		Block:       []byte(info),
+	})
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to write WARC file %s: %w", fileName, err)
+	}
+	return w, nil
+}
+
+// write appends the records in order, with nothing from other calls
+// between them.
+func (w *warcWriter) write(records ...warcRecord) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, rec := range records {
+		zw := gzip.NewWriter(w.file)
+		fmt.Fprintf(zw, "WARC/1.1\r\nWARC-Type: %s\r\nWARC-Record-ID: <%s>\r\nWARC-Date: %s\r\n",
+			rec.Type, rec.ID, rec.Date.Format(time.RFC3339))
+		if rec.Type == "warcinfo" {
+			fmt.Fprintf(zw, "WARC-Filename: %s\r\n", filepath.Base(w.file.Name()))
+		}
+		if rec.TargetURI != "" {
+			fmt.Fprintf(zw, "WARC-Target-URI: %s\r\n", rec.TargetURI)
+		}
+		if rec.ConcurrentTo != "" {
+			fmt.Fprintf(zw, "WARC-Concurrent-To: <%s>\r\n", rec.ConcurrentTo)
+		}
+		if rec.PayloadDigest != "" {
+			fmt.Fprintf(zw, "WARC-Payload-Digest: %s\r\n", rec.PayloadDigest)
+		}
+		fmt.Fprintf(zw, "WARC-Block-Digest: %s\r\nContent-Type: %s\r\nContent-Length: %d\r\n\r\n",
+			warcDigest(rec.Block), rec.ContentType, len(rec.Block))
+		zw.Write(rec.Block)
+		io.WriteString(zw, "\r\n\r\n")
+		if err := zw.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *warcWriter) Close() error {
+	return w.file.Close()
+}
+
+// newRecordID returns a random (version 4) UUID URN.
+func newRecordID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("urn:uuid:%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// warcDigest returns the SHA-1 digest of b in the base32 form WARC uses.
+func warcDigest(b []byte) string {
+	sum := sha1.Sum(b)
+	return "sha1:" + base32.StdEncoding.EncodeToString(sum[:])
+}
+
+// pageURLKey is the context key of the article URL a request is made
+// for.
+type pageURLKey struct{}
+
+// withPageURL returns a context whose requests are made for the article
+// at pageURL, which the archive records next to their responses.
+func withPageURL(ctx context.Context, pageURL string) context.Context {
+	return context.WithValue(ctx, pageURLKey{}, pageURL)
+}
+
+// pageTransport makes every request for the article at pageURL. colly
+// requests carry no context of their own, so scrapeHTML gives the
+// collector of each page one of these.
+type pageTransport struct {
+	pageURL string
+	next    http.RoundTripper // nil means http.DefaultTransport
+}
+
+func (t *pageTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	next := t.next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return next.RoundTrip(req.WithContext(withPageURL(req.Context(), t.pageURL)))
+}
+
+// warcTransport is an http.RoundTripper that archives every request and
+// the response it got. The response is stored as the scraper received
+// it: with the body decompressed and de-chunked, and Content-Length set
+// to the length of that body. A request made for an article page is
+// followed by a metadata record naming the page, since after a redirect
+// neither the request nor the response has its URL.
+type warcTransport struct {
+	archive *warcWriter
+	next    http.RoundTripper // nil means http.DefaultTransport
+}
+
+func (t *warcTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	next := t.next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	resp, err := next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	// The scraper only sends GET requests, which have no body.
+	request, err := httputil.DumpRequest(req, false)
+	if err != nil {
+		return nil, err
+	}
+	var response bytes.Buffer
+	major, minor := resp.ProtoMajor, resp.ProtoMinor
+	if major == 0 {
+		major, minor = 1, 1
+	}
+	fmt.Fprintf(&response, "HTTP/%d.%d %s\r\n", major, minor, resp.Status)
+	header := resp.Header.Clone()
+	header.Del("Transfer-Encoding")
+	if resp.Uncompressed {
+		header.Del("Content-Encoding")
+	}
+	header.Set("Content-Length", strconv.Itoa(len(body)))
+	header.Write(&response)
+	response.WriteString("\r\n")
+	response.Write(body)
+
+	now := time.Now().UTC()
+	responseID := newRecordID()
+	records := []warcRecord{
+		{
+			Type:         "request",
+			ID:           newRecordID(),
+			Date:         now,
+			TargetURI:    req.URL.String(),
+			ConcurrentTo: responseID,
+			ContentType:  "application/http;msgtype=request",
+			Block:        request,
+		},
+		{
+			Type:          "response",
+			ID:            responseID,
+			Date:          now,
+			TargetURI:     req.URL.String(),
+			ContentType:   "application/http;msgtype=response",
+			PayloadDigest: warcDigest(body),
+			Block:         response.Bytes(),
+		},
+	}
+	if pageURL, ok := req.Context().Value(pageURLKey{}).(string); ok {
+		records = append(records, warcRecord{
+			Type:         "metadata",
+			ID:           newRecordID(),
+			Date:         now,
+			TargetURI:    req.URL.String(),
+			ConcurrentTo: responseID,
+			ContentType:  "application/warc-fields",
+			Block:        []byte("page-url: " + pageURL + "\r\n"),
+		})
+	}
+	err = t.archive.write(records...)
+	if err != nil {
+		fmt.Printf("Error archiving %s: %v\n", req.URL, err)
+	}
+	return resp, nil
+}
+
+// warcReader reads the records of a WARC file, compressed per record,
+// as a whole or not at all.
+type warcReader struct {
+	file *os.File
+	text *textproto.Reader
+}
+
+func openWARC(fileName string) (*warcReader, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open WARC file %s: %w", fileName, err)
+	}
+	br := bufio.NewReader(file)
+	if magic, _ := br.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to read WARC file %s: %w", fileName, err)
+		}
+		br = bufio.NewReader(zr)
+	}
+	return &warcReader{file: file, text: textproto.NewReader(br)}, nil
+}
+
+// next returns the next record, or io.EOF after the last one.
+func (r *warcReader) next() (warcRecord, error) {
+	var version string
+	for version == "" {
+		line, err := r.text.ReadLine()
+		if err != nil {
+			if err == io.EOF && line == "" {
+				return warcRecord{}, io.EOF
+			}
+			return warcRecord{}, err
+		}
+		version = strings.TrimSpace(line)
+	}
+	if !strings.HasPrefix(version, "WARC/") {
+		return warcRecord{}, fmt.Errorf("invalid WARC record: starts with %q", version)
+	}
+	header, err := r.text.ReadMIMEHeader()
+	if err != nil {
+		return warcRecord{}, fmt.Errorf("invalid WARC record header: %w", err)
+	}
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil || length < 0 {
+		return warcRecord{}, fmt.Errorf("invalid WARC Content-Length %q", header.Get("Content-Length"))
+	}
+	rec := warcRecord{
+		Type:          header.Get("WARC-Type"),
+		ID:            strings.Trim(header.Get("WARC-Record-ID"), "<>"),
+		TargetURI:     header.Get("WARC-Target-URI"),
+		ConcurrentTo:  strings.Trim(header.Get("WARC-Concurrent-To"), "<>"),
+		ContentType:   header.Get("Content-Type"),
+		PayloadDigest: header.Get("WARC-Payload-Digest"),
+		Block:         make([]byte, length),
+	}
+	rec.Date, _ = time.Parse(time.RFC3339, header.Get("WARC-Date"))
+	if _, err := io.ReadFull(r.text.R, rec.Block); err != nil {
+		return warcRecord{}, fmt.Errorf("truncated WARC record %s: %w", rec.ID, err)
+	}
+	return rec, nil
+}
+
+func (r *warcReader) Close() error {
+	return r.file.Close()
+}
+
+// replayRecord parses an archived response the way the scraper parsed
+// it when it was fetched. Article pages go through ParseArticle and
+// action=parse responses of the MediaWiki API through the API parser.
+// ok is false for everything else: failed requests, robots.txt, category
+// listings and API queries. The record gets pageURL, the URL the scraper
+// was asked for. named says whether the archive names the pages of its
+// responses at all; if it does, an HTML response without a page URL was
+// not fetched as an article. Older archives do not, so their article
+// pages get the URL they were fetched from, which on Wikipedia must be
+// an article path, and API pages get that of their title.
+func replayRecord(rec warcRecord, pageURL string, named bool, profiles []*SiteProfile) (data WebsiteData, ok bool, err error) {
+	if rec.Type != "response" || !strings.HasPrefix(rec.ContentType, "application/http") {
+		return WebsiteData{}, false, nil
+	}
+	target, err := url.Parse(rec.TargetURI)
+	if err != nil {
+		return WebsiteData{}, false, fmt.Errorf("invalid target URI %s: %w", rec.TargetURI, err)
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(rec.Block)), nil)
+	if err != nil {
+		return WebsiteData{}, false, fmt.Errorf("invalid response for %s: %w", rec.TargetURI, err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return WebsiteData{}, false, fmt.Errorf("invalid response for %s: %w", rec.TargetURI, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return WebsiteData{}, false, nil
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	switch {
+	case strings.HasPrefix(contentType, "text/html"):
+		if pageURL == "" {
+			if named || (profileFor(target.Hostname(), profiles) == wikipediaProfile && !isWikiArticleURL(target)) {
+				return WebsiteData{}, false, nil
+			}
+			pageURL = rec.TargetURI
+		}
+		data, err := ParseArticle(bytes.NewReader(body), pageURL, profiles...)
+		return data, err == nil, err
+	case strings.HasPrefix(contentType, "application/json") && target.Query().Get("action") == "parse":
+		var result apiParseResult
+		if err := json.Unmarshal(body, &result); err != nil {
+			return WebsiteData{}, false, fmt.Errorf("invalid response for %s: %w", rec.TargetURI, err)
+		}
+		if result.Error != nil {
+			return WebsiteData{}, false, nil
+		}
+		if pageURL == "" {
+			client := &apiClient{base: target.Scheme + "://" + target.Host}
+			pageURL = client.pageURL(result.Parse.Title)
+		}
+		data, err := result.record(pageURL)
+		return data, err == nil, err
+	}
+	return WebsiteData{}, false, nil
+}
+
+// isWikiArticleURL reports whether u is the URL of a wiki article rather
+// than a category page, including the index.php?title=Category:...
+// pages that continue a category listing.
+func isWikiArticleURL(u *url.URL) bool {
+	title, ok := strings.CutPrefix(u.Path, "/wiki/")
+	if !ok || title == "" || strings.HasPrefix(title, "Category:") {
+		return false
+	}
+	return !strings.HasPrefix(u.Query().Get("title"), "Category:")
+}
+
+// warcPageURLs returns the article URLs that the metadata records of a
+// WARC file name, by the ID of the response they belong to.
+func warcPageURLs(fileName string) (map[string]string, error) {
+	r, err := openWARC(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	pages := map[string]string{}
+	for {
+		rec, err := r.next()
+		if err == io.EOF {
+			return pages, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read WARC file %s: %w", fileName, err)
+		}
+		if rec.Type != "metadata" || rec.ConcurrentTo == "" {
+			continue
+		}
+		fields, err := textproto.NewReader(bufio.NewReader(bytes.NewReader(rec.Block))).ReadMIMEHeader()
+		if err != nil && err != io.EOF {
+			return nil, fmt.Errorf("invalid metadata record %s: %w", rec.ID, err)
+		}
+		if pageURL := fields.Get("Page-Url"); pageURL != "" {
+			pages[rec.ConcurrentTo] = pageURL
+		}
+	}
+}
+
+// replayWARC parses every archived page of a WARC file with opts.profiles
+// and finishes the records as scrape does, with summaries of opts.summary
+// sentences and tables below opts.outDir. Records get the URL the
+// scraper was asked for, even when the page was redirected. When a page
+// was fetched more than once, the last response wins but keeps the
+// position of the first.
+func replayWARC(fileName string, opts scrapeOptions) ([]WebsiteData, error) {
+	// The metadata records follow their responses, so they are read first.
+	pages, err := warcPageURLs(fileName)
+	if err != nil {
+		return nil, err
+	}
+	r, err := openWARC(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	var records []WebsiteData
+	position := map[string]int{}
+	for {
+		rec, err := r.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return records, fmt.Errorf("failed to read WARC file %s: %w", fileName, err)
+		}
+		data, ok, err := replayRecord(rec, pages[rec.ID], len(pages) > 0, opts.profiles)
+		if err != nil {
+			fmt.Printf("Error replaying %s: %v\n", rec.TargetURI, err)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if i, seen := position[data.URL]; seen {
+			records[i] = data
+			continue
+		}
+		position[data.URL] = len(records)
+		records = append(records, data)
+	}
+	for i := range records {
+		finishRecord(&records[i], opts)
+	}
+	return records, nil
+}
+
+// runReplay implements the "replay" command, which parses the pages of a
+// WARC file written with --warc again, without touching the network, so
+// that changes to the extraction can be applied to old snapshots.
+func runReplay(args []string) int {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	input := fs.String("input", "wikipedia_pages.warc.gz", "WARC file written by a scrape with --warc")
+	output := fs.String("output", "wikipedia_data.replay.jsonl", "JSON lines file for the records")
+	profileFile := fs.String("profiles", "", "JSON site profile, or a directory of them, as for the scrape")
+	outDir := fs.String("out-dir", ".", "directory the tables/ files are written below")
+	summary := fs.Int("summary-sentences", 3, "sentences per article and section summary, as for the scrape; 0 writes none")
+	fs.Parse(args)
+
+	if *summary < 0 {
+		fmt.Println("Error: -summary-sentences must not be negative")
+		return 2
+	}
+	opts := scrapeOptions{outDir: *outDir, summary: *summary}
+	if *profileFile != "" {
+		var err error
+		if opts.profiles, err = loadSiteProfiles(*profileFile); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 2
+		}
+	}
+
+	records, err := replayWARC(*input, opts)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+
+	if err := writeJSONLFile(*output, records); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	for _, data := range records {
+		fmt.Printf("Replayed %s: %s (Sections: %d)\n", data.URL, data.Title, len(data.Sections))
+	}
+	fmt.Printf("\n%d articles from %s written to %s\n", len(records), *input, *output)
+	return 0
+}
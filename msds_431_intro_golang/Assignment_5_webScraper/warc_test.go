@@ -0,0 +1,345 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readWARC returns every record of a WARC file.
+func readWARC(t *testing.T, fileName string) []warcRecord {
+	t.Helper()
+	r, err := openWARC(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	var records []warcRecord
+	for {
+		rec, err := r.next()
+		if err == io.EOF {
+			return records
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, rec)
+	}
+}
+
+func TestWARCWriterAndReader(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "pages.warc.gz")
+	w, err := newWARCWriter(file, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	date := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	page := warcRecord{
+		Type:        "response",
+		ID:          newRecordID(),
+		Date:        date,
+		TargetURI:   "https://en.wikipedia.org/wiki/Robotics",
+		ContentType: "application/http;msgtype=response",
+		Block:       []byte("HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nhi"),
+	}
+	if err := w.write(page); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	// Appending keeps the earlier records and adds a warcinfo record.
+	w, err = newWARCWriter(file, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	records := readWARC(t, file)
+	var types []string
+	for _, rec := range records {
+		types = append(types, rec.Type)
+	}
+	if strings.Join(types, ",") != "warcinfo,response,warcinfo" {
+		t.Fatalf("record types = %v", types)
+	}
+	got := records[1]
+	if got.ID != page.ID || !got.Date.Equal(date) || got.TargetURI != page.TargetURI ||
+		got.ContentType != page.ContentType || !bytes.Equal(got.Block, page.Block) {
+		t.Errorf("read %+v, wrote %+v", got, page)
+	}
+	if !strings.HasPrefix(records[0].ID, "urn:uuid:") || len(records[0].ID) != len("urn:uuid:")+36 {
+		t.Errorf("record ID %q is not a UUID URN", records[0].ID)
+	}
+
+	// Every record is a gzip member of its own.
+	raw, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	zr.Multistream(false)
+	first, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(first), "WARC/1.1\r\nWARC-Type: warcinfo\r\n") || !strings.HasSuffix(string(first), "\r\n\r\n") ||
+		strings.Contains(string(first), "WARC-Type: response") {
+		t.Errorf("first gzip member is not exactly the warcinfo record:\n%s", first)
+	}
+	if !strings.Contains(string(first), "WARC-Block-Digest: sha1:") {
+		t.Errorf("warcinfo record has no block digest:\n%s", first)
+	}
+}
+
+// TestScrapeWARCReplay archives a scrape and checks that replaying the
+// archive gives the same records without a server.
+func TestScrapeWARCReplay(t *testing.T) {
+	srv := newFixtureServer(t)
+	file := filepath.Join(t.TempDir(), "pages.warc.gz")
+	archive, err := newWARCWriter(file, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	urls := []string{srv.URL + "/wiki/Robotics", srv.URL + "/wiki/Chatbot", srv.URL + "/wiki/Missing"}
+	scrapeDir := t.TempDir()
+	opts := scrapeOptions{outDir: scrapeDir, transport: &warcTransport{archive: archive}, order: orderInput, summary: 3}
+	scraped := scrape(context.Background(), urls, &bytes.Buffer{}, opts)
+	archive.Close()
+	srv.Close()
+
+	records := readWARC(t, file)
+	if len(records) != 1+3*len(urls) {
+		t.Fatalf("got %d records, want a warcinfo record and a request, response and metadata record per URL", len(records))
+	}
+	responses := map[string]warcRecord{}
+	for _, rec := range records {
+		if rec.Type == "response" {
+			responses[rec.ID] = rec
+		}
+	}
+	for _, rec := range records {
+		switch rec.Type {
+		case "request":
+			resp, ok := responses[rec.ConcurrentTo]
+			if !ok || resp.TargetURI != rec.TargetURI {
+				t.Errorf("request for %s has no matching response", rec.TargetURI)
+			}
+			if !strings.HasPrefix(string(rec.Block), "GET /wiki/") {
+				t.Errorf("request block = %q", rec.Block)
+			}
+			if !strings.HasPrefix(string(resp.Block), "HTTP/1.1 ") || resp.PayloadDigest == "" {
+				t.Errorf("response for %s = %q, digest %q", resp.TargetURI, resp.Block, resp.PayloadDigest)
+			}
+		case "metadata":
+			if _, ok := responses[rec.ConcurrentTo]; !ok {
+				t.Errorf("metadata record for %s has no matching response", rec.TargetURI)
+			}
+			if want := "page-url: " + rec.TargetURI + "\r\n"; string(rec.Block) != want {
+				t.Errorf("metadata block = %q, want %q", rec.Block, want)
+			}
+		}
+	}
+
+	replayDir := t.TempDir()
+	replayed, err := replayWARC(file, scrapeOptions{outDir: replayDir, summary: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(replayed) != len(scraped) || len(scraped) != 2 {
+		t.Fatalf("replayed %d records, scraped %d", len(replayed), len(scraped))
+	}
+	for i := range scraped {
+		if scraped[i].Summary == "" {
+			t.Errorf("scraped record for %s has no summary", scraped[i].URL)
+		}
+		if mustJSON(t, replayed[i]) != mustJSON(t, scraped[i]) {
+			t.Errorf("replayed record for %s differs from the scraped one", scraped[i].URL)
+		}
+	}
+
+	// The replay writes the same table files as the scrape.
+	tables, err := filepath.Glob(filepath.Join(scrapeDir, "tables", "*"))
+	if err != nil || len(tables) == 0 {
+		t.Fatalf("the scrape wrote no tables: %v", err)
+	}
+	for _, name := range tables {
+		want, _ := os.ReadFile(name)
+		got, err := os.ReadFile(filepath.Join(replayDir, "tables", filepath.Base(name)))
+		if err != nil || !bytes.Equal(got, want) {
+			t.Errorf("replayed table %s differs from the scraped one: %v", filepath.Base(name), err)
+		}
+	}
+}
+
+// TestReplayAPI replays an archive of a scrape through the MediaWiki
+// API. Only the action=parse responses become records.
+func TestReplayAPI(t *testing.T) {
+	srv := newAPIServer(t)
+	file := filepath.Join(t.TempDir(), "pages.warc")
+	archive, err := newWARCWriter(file, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	urls := []string{srv.URL + "/wiki/Robotics", srv.URL + "/wiki/Chatbots"}
+	opts := scrapeOptions{outDir: t.TempDir(), transport: &warcTransport{archive: archive}, source: "api", order: orderInput}
+	scraped := scrape(context.Background(), urls, &bytes.Buffer{}, opts)
+	archive.Close()
+
+	replayed, err := replayWARC(file, scrapeOptions{outDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]WebsiteData{}
+	for _, data := range replayed {
+		got[data.URL] = data
+	}
+	if len(got) != 2 {
+		t.Fatalf("replayed %d records, want 2", len(got))
+	}
+	// Chatbots redirects to Chatbot; its record keeps the requested URL,
+	// as in the scrape.
+	for i, u := range urls {
+		if mustJSON(t, got[u]) != mustJSON(t, scraped[i]) {
+			t.Errorf("replayed record for %s differs from the scraped one", u)
+		}
+	}
+}
+
+// TestReplayRedirect replays an archive of article pages that were
+// redirected. The records keep the URLs the scrape was asked for.
+func TestReplayRedirect(t *testing.T) {
+	fixtures := newFixtureServer(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, fixtures.URL+"/wiki/Robotics", http.StatusMovedPermanently)
+	}))
+	defer srv.Close()
+
+	file := filepath.Join(t.TempDir(), "pages.warc.gz")
+	archive, err := newWARCWriter(file, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	urls := []string{srv.URL + "/wiki/Robots", fixtures.URL + "/wiki/Chatbot"}
+	opts := scrapeOptions{outDir: t.TempDir(), transport: &warcTransport{archive: archive}, order: orderInput}
+	scraped := scrape(context.Background(), urls, &bytes.Buffer{}, opts)
+	archive.Close()
+	if len(scraped) != len(urls) || scraped[0].URL != urls[0] {
+		t.Fatalf("scraped %v", scraped)
+	}
+
+	replayed, err := replayWARC(file, scrapeOptions{outDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(replayed) != len(scraped) {
+		t.Fatalf("replayed %d records, scraped %d", len(replayed), len(scraped))
+	}
+	for i := range scraped {
+		if mustJSON(t, replayed[i]) != mustJSON(t, scraped[i]) {
+			t.Errorf("replayed record for %s differs from the scraped one: URL %s", scraped[i].URL, replayed[i].URL)
+		}
+	}
+}
+
+// TestReplayCategoryCrawl replays an archive of a paginated category
+// crawl and the scrape of its members. Only the member articles become
+// records, whether or not the archive names the page of each response.
+func TestReplayCategoryCrawl(t *testing.T) {
+	srv := newFixtureServer(t)
+	dir := t.TempDir()
+	file := filepath.Join(dir, "pages.warc.gz")
+	archive, err := newWARCWriter(file, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := scrapeOptions{outDir: t.TempDir(), transport: &warcTransport{archive: archive}, order: orderInput}
+	members, err := crawlCategory(context.Background(), categoryURL(srv.URL, "Robotics"), 0, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scrape(context.Background(), members[:2], &bytes.Buffer{}, opts)
+	archive.Close()
+
+	// An archive written before pages were named has no metadata records.
+	unnamed := filepath.Join(dir, "unnamed.warc.gz")
+	old, err := newWARCWriter(unnamed, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var listings int
+	for _, rec := range readWARC(t, file) {
+		if strings.Contains(rec.TargetURI, "Category:") {
+			listings++
+		}
+		if rec.Type == "request" || rec.Type == "response" {
+			old.write(rec)
+		}
+	}
+	old.Close()
+	if listings < 4 {
+		t.Fatalf("the archive has %d records of category listings, want both pages", listings)
+	}
+
+	for _, fileName := range []string{file, unnamed} {
+		t.Run(filepath.Base(fileName), func(t *testing.T) {
+			replayed, err := replayWARC(fileName, scrapeOptions{outDir: t.TempDir()})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var urls []string
+			for _, data := range replayed {
+				urls = append(urls, data.URL)
+			}
+			if strings.Join(urls, " ") != strings.Join(members[:2], " ") {
+				t.Errorf("replayed %v, want %v", urls, members[:2])
+			}
+		})
+	}
+}
+
+func TestRunReplay(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "pages.warc.gz")
+	archive, err := newWARCWriter(input, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := newFixtureServer(t)
+	target, _ := url.Parse(srv.URL)
+	opts := scrapeOptions{outDir: dir, transport: &warcTransport{archive: archive, next: hostRewriter{target}}}
+	scrape(context.Background(), []string{blogURL, fixtures["robotics"]}, &bytes.Buffer{}, opts)
+	archive.Close()
+
+	output := filepath.Join(dir, "replay.jsonl")
+	profileFile := filepath.Join("testdata", "profiles", "maker_notes.json")
+	if code := runReplay([]string{"-input", input, "-output", output, "-profiles", profileFile, "-out-dir", dir}); code != 0 {
+		t.Fatalf("runReplay returned %d", code)
+	}
+	records, err := readRecords(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	titles := map[string]string{}
+	for _, data := range records {
+		titles[data.URL] = data.Title
+	}
+	if titles[blogURL] != "Choosing a robot arm" || titles[fixtures["robotics"]] != "Robotics" {
+		t.Errorf("replayed titles = %v", titles)
+	}
+
+	if code := runReplay([]string{"-input", filepath.Join(dir, "missing.warc.gz"), "-output", output}); code != 1 {
+		t.Errorf("runReplay with a missing input returned %d, want 1", code)
+	}
+}